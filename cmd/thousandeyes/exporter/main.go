@@ -2,12 +2,18 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	thousandeyes "github.com/sapcc/1000eyes_exporter/pkg/thousandeyes"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 )
 
 var evThousandeyesBearerToken = "THOUSANDEYES_BEARER_TOKEN"
@@ -17,7 +23,27 @@ var evThousandeyesBasicAuthToken = "THOUSANDEYES_BASIC_AUTH_TOKEN"
 var bGetBGP = flag.Bool("GetBGP", false, "-GetBGP=true [true|false (default)] if you want BGP test data collected")
 var bGetHTTP = flag.Bool("GetHTTP", false, "-GetHTTP=true [true|false (default)] if you want HTTP request test data collected")
 var bGetHttpMetrics = flag.Bool("GetHttpMetrics", false, "-GetHttpMetrics=true [true|false (default)] if you want HTTP routing test data collected")
+var bGetPageLoad = flag.Bool("GetPageLoad", false, "-GetPageLoad=true [true|false (default)] if you want page load test data collected")
+var bGetTransactions = flag.Bool("GetTransactions", false, "-GetTransactions=true [true|false (default)] if you want transaction test data collected")
+var bGetDNS = flag.Bool("GetDNS", false, "-GetDNS=true [true|false (default)] if you want DNS server and DNS trace test data collected")
+var bGetDNSSEC = flag.Bool("GetDNSSEC", false, "-GetDNSSEC=true [true|false (default)] if you want DNSSEC test data collected")
+var bGetNetwork = flag.Bool("GetNetwork", false, "-GetNetwork=true [true|false (default)] if you want agent to server test data collected")
+var bGetAgentToAgent = flag.Bool("GetAgentToAgent", false, "-GetAgentToAgent=true [true|false (default)] if you want agent to agent test data collected")
+var bGetPathVis = flag.Bool("GetPathVis", false, "-GetPathVis=true [true|false (default)] if you want path visualization summaries of the network tests collected")
+var bGetBGPRoutes = flag.Bool("GetBGPRoutes", false, "-GetBGPRoutes=true [true|false (default)] if you want BGP route data (origin AS, AS paths) collected")
+var bGetVoice = flag.Bool("GetVoice", false, "-GetVoice=true [true|false (default)] if you want voice (RTP stream) test data collected")
+var bGetSIPServer = flag.Bool("GetSIPServer", false, "-GetSIPServer=true [true|false (default)] if you want SIP server test data collected")
+var bGetFTPServer = flag.Bool("GetFTPServer", false, "-GetFTPServer=true [true|false (default)] if you want FTP server test data collected")
+var bGetAgents = flag.Bool("GetAgents", false, "-GetAgents=true [true|false (default)] if you want the agents of the account groups (inventory, state, utilization) collected")
+var bGetEndpointAgents = flag.Bool("GetEndpointAgents", false, "-GetEndpointAgents=true [true|false (default)] if you want endpoint agent status and scheduled endpoint test data collected, aggregated by location")
+var bGetAlertRules = flag.Bool("GetAlertRules", false, "-GetAlertRules=true [true|false (default)] if you want the alert rules and the tests they are assigned to collected")
+var timezone = flag.String("Timezone", "", "-Timezone=<IANA timezone name> timezone of the ThousandEyes account the v6 API gives dates in (default: UTC)")
 var retrospectionPeriod = flag.Duration( "RetrospectionPeriodInSec", 0, "give a time going back in Seconds, examples: 10h | 1h10m10s")
+var accountGroups = flag.String("AccountGroups", "", "-AccountGroups=all | comma separated account group names or aids to scrape (default: the default account group of the token)")
+var accountGroupRegex = flag.String("AccountGroupRegex", "", "-AccountGroupRegex=<regex> scrape the account groups with a matching name (in addition to -AccountGroups)")
+var configFile = flag.String("ConfigFile", "", "YAML config file, reloaded on SIGHUP or POST /-/reload (default: the flags and environment values are used)")
+var apiVersion = flag.String("APIVersion", "v6", "-APIVersion=v7 [v6 (default)|v7] ThousandEyes API version to use")
+var pollInterval = flag.Duration("PollInterval", 60*time.Second, "time between two refreshes of the ThousandEyes data in the background, examples: 30s | 5m")
 
 func main() {
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
@@ -27,44 +53,36 @@ func main() {
 	thousandeyes.ThousandRequestsetRospectionPeriodMetric.Set(thousandeyes.RetrospectionPeriod.Seconds())
 	log.Printf("INFO: History Debug AlertScraping %d", thousandeyes.RetrospectionPeriod)
 
-	isBasicAuth:= false
-	user  := ""
-	token := os.Getenv(evThousandeyesBearerToken)
-
-	//tbd: refreshToken := os.Getenv("THOUSANDEYES_REFRESH_TOKEN")
-
-	if token == "" {
-
-		user  = os.Getenv(evThousandeyesBasicAuthUser)
-		token = os.Getenv(evThousandeyesBasicAuthToken)
-
-		if token == "" || user == "" {
-			log.Fatalf("error: %s or the combination of %s and %s must be set in the Environment Values - something is empty.", evThousandeyesBearerToken, evThousandeyesBasicAuthUser, evThousandeyesBasicAuthToken)
-		}
-		token = os.Getenv(evThousandeyesBasicAuthToken)
-		if token == "" {
-			log.Fatalf("error: %s or the combination of %s and %s must be set in the Environment Values - something is empty.", evThousandeyesBearerToken, evThousandeyesBasicAuthUser, evThousandeyesBasicAuthToken)
-		}
-		log.Print("INFO: We use Basic Auth Token for Authentication.")
-		isBasicAuth = true
-	} else {
-		log.Print("INFO: We use Bearer Token for Authentication.")
+	e := &exporter{}
+	if err := e.reload(); err != nil {
+		log.Fatalf("error: %s", err)
 	}
 
-	var c = &thousandeyes.Collector{
-		Token : token,
-		User: user,
-		IsBasicAuth: isBasicAuth,
-		IsCollectBgp : *bGetBGP,
-		IsCollectHttp : *bGetHTTP,
-		IsCollectHttpMetrics: *bGetHttpMetrics,
-	}
-	prometheus.Register(c)
-
-
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if err := e.reload(); err != nil {
+				log.Printf("ERROR: %s", err)
+			}
+		}
+	}()
 
 	// make Prometheus client aware of our collector
 	http.Handle("/metrics", promhttp.Handler())
+	http.HandleFunc("/probe", func(w http.ResponseWriter, r *http.Request) {
+		e.current().ProbeHandler(w, r)
+	})
+	http.HandleFunc("/-/reload", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "use POST to reload the config", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := e.reload(); err != nil {
+			log.Printf("ERROR: %s", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		_, _ = w.Write([]byte(
 			`<html>
@@ -72,6 +90,7 @@ func main() {
 			<body>
 			<h1>ThousandEyes Alert Exporter</h1>
 			<p><a href="/metrics">Metrics</a></p>
+			<p>Probe: /probe?test_id=&lt;test id&gt;[,&lt;test id&gt;...]&amp;module=&lt;module&gt;</p>
 			<p><a href="https://github.com/sapcc/1000eyes_exporter">Git Repository</a></p>
 			<p><a href="https://www.thousandeyes.com/">thousandeyes home</a></p>
 			</body>
@@ -85,3 +104,187 @@ func main() {
 	log.Fatal(http.ListenAndServe(port, nil))
 
 }
+
+// exporter holds the collector of the config in use, it is replaced on every reload
+type exporter struct {
+	mu         sync.Mutex
+	collector  *thousandeyes.Collector
+	registerer prometheus.Registerer
+	stop       chan struct{}
+	done       chan struct{}
+
+	// reloadMu serializes the reloads, so there is never more than one poller calling the API
+	reloadMu sync.Mutex
+}
+
+func (e *exporter) current() *thousandeyes.Collector {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.collector
+}
+
+// reload loads and validates the config and swaps the collector, the old one is kept if anything fails
+func (e *exporter) reload() error {
+	cfg, err := loadConfig()
+	if err == nil {
+		err = e.apply(cfg)
+	}
+	if err != nil {
+		thousandeyes.ThousandConfigLastReloadSuccessful.Set(0)
+		return err
+	}
+
+	thousandeyes.ThousandConfigLastReloadSuccessful.Set(1)
+	thousandeyes.ThousandConfigLastReloadSuccessTimestamp.Set(float64(time.Now().Unix()))
+	thousandeyes.ThousandConfigHash.Set(cfg.Hash)
+	log.Print("INFO: Config loaded.")
+	return nil
+}
+
+func (e *exporter) apply(cfg *thousandeyes.Config) error {
+	c, err := cfg.NewCollector()
+	if err != nil {
+		return err
+	}
+	registerer := prometheus.WrapRegistererWith(prometheus.Labels(cfg.Labels), prometheus.DefaultRegisterer)
+
+	e.reloadMu.Lock()
+	defer e.reloadMu.Unlock()
+
+	e.mu.Lock()
+	old, oldStop, oldDone := e.collector, e.stop, e.done
+	if old != nil {
+		e.registerer.Unregister(old)
+	}
+	if err := registerer.Register(c); err != nil {
+		if old != nil {
+			_ = e.registerer.Register(old)
+		}
+		e.mu.Unlock()
+		return fmt.Errorf("collector could not be registered: %s", err)
+	}
+	if old != nil {
+		c.InheritSnapshot(old)
+	}
+	e.collector = c
+	e.registerer = registerer
+	e.stop = make(chan struct{})
+	e.done = make(chan struct{})
+	stop, done := e.stop, e.done
+	e.mu.Unlock()
+
+	// the pollers share the rate limiter of the API,
+	// so the old one has to finish its refresh before the new one starts
+	if old != nil {
+		close(oldStop)
+		<-oldDone
+		c.InheritSnapshot(old)
+	}
+
+	// the API is only called by the poller, scrapes are served from its snapshot
+	go c.Run(stop, done)
+	return nil
+}
+
+// loadConfig reads the config file or builds the config from the flags,
+// credentials missing in the config are taken from the environment values
+func loadConfig() (*thousandeyes.Config, error) {
+	var cfg *thousandeyes.Config
+	if *configFile != "" {
+		var err error
+		cfg, err = thousandeyes.LoadConfig(*configFile)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		cfg = configFromFlags()
+	}
+
+	if cfg.Credentials == (thousandeyes.CredentialsConfig{}) {
+		cfg.Credentials = credentialsFromEnv()
+	}
+	if cfg.Credentials.IsBasicAuth() {
+		log.Print("INFO: We use Basic Auth Token for Authentication.")
+	} else {
+		log.Print("INFO: We use Bearer Token for Authentication.")
+	}
+
+	return cfg, cfg.Validate()
+}
+
+func credentialsFromEnv() thousandeyes.CredentialsConfig {
+	//tbd: refreshToken := os.Getenv("THOUSANDEYES_REFRESH_TOKEN")
+	return thousandeyes.CredentialsConfig{
+		BearerToken:    os.Getenv(evThousandeyesBearerToken),
+		BasicAuthUser:  os.Getenv(evThousandeyesBasicAuthUser),
+		BasicAuthToken: os.Getenv(evThousandeyesBasicAuthToken),
+	}
+}
+
+// configFromFlags is the config if no config file is given
+func configFromFlags() *thousandeyes.Config {
+	cfg := &thousandeyes.Config{
+		APIVersion:     *apiVersion,
+		Timezone:       *timezone,
+		Families:       flagFamilies(),
+		Agents:         thousandeyes.AgentsConfig{Enabled: *bGetAgents},
+		EndpointAgents: thousandeyes.EndpointAgentsConfig{Enabled: *bGetEndpointAgents},
+		AlertRules:     thousandeyes.AlertRulesConfig{Enabled: *bGetAlertRules},
+		Polling: thousandeyes.PollingConfig{
+			Interval: *pollInterval,
+		},
+	}
+	if *accountGroups != "" {
+		cfg.AccountGroups.Names = strings.Split(*accountGroups, ",")
+	}
+	cfg.AccountGroups.Regex = *accountGroupRegex
+	return cfg
+}
+
+// flagFamilies are the result families enabled by the flags
+func flagFamilies() []string {
+	families := []string{}
+	if *bGetBGP {
+		families = append(families, thousandeyes.FamilyBGP)
+	}
+	if *bGetHTTP {
+		families = append(families, thousandeyes.FamilyHTTP)
+	}
+	if *bGetHttpMetrics {
+		families = append(families, thousandeyes.FamilyHTTPMetrics)
+	}
+	if *bGetPageLoad {
+		families = append(families, thousandeyes.FamilyPageLoad)
+	}
+	if *bGetTransactions {
+		families = append(families, thousandeyes.FamilyTransaction)
+	}
+	if *bGetDNS {
+		families = append(families, thousandeyes.FamilyDNS)
+	}
+	if *bGetDNSSEC {
+		families = append(families, thousandeyes.FamilyDNSSEC)
+	}
+	if *bGetNetwork {
+		families = append(families, thousandeyes.FamilyNetwork)
+	}
+	if *bGetAgentToAgent {
+		families = append(families, thousandeyes.FamilyAgentToAgent)
+	}
+	if *bGetPathVis {
+		families = append(families, thousandeyes.FamilyPathVis)
+	}
+	if *bGetBGPRoutes {
+		families = append(families, thousandeyes.FamilyBGPRoutes)
+	}
+	if *bGetVoice {
+		families = append(families, thousandeyes.FamilyVoice)
+	}
+	if *bGetSIPServer {
+		families = append(families, thousandeyes.FamilySIPServer)
+	}
+	if *bGetFTPServer {
+		families = append(families, thousandeyes.FamilyFTPServer)
+	}
+	return families
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	thousandeyes "github.com/sapcc/1000eyes_exporter/pkg/thousandeyes"
+)
+
+// the exporter has to start with the token in the environment only, the -Get* flags are optional
+func TestLoadConfigFromFlags(t *testing.T) {
+	defer func(token string) { _ = os.Setenv(evThousandeyesBearerToken, token) }(os.Getenv(evThousandeyesBearerToken))
+	_ = os.Setenv(evThousandeyesBearerToken, "token")
+
+	tests := []struct {
+		name         string
+		getBGP       bool
+		wantHandlers int
+		wantDefault  bool
+	}{
+		{"token only", false, 0, false},
+		{"token and -GetBGP", true, 1, true},
+	}
+
+	defer func(b bool) { *bGetBGP = b }(*bGetBGP)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			*bGetBGP = tt.getBGP
+
+			cfg, err := loadConfig()
+			if err != nil {
+				t.Fatalf("config of the flags: %s", err)
+			}
+			c, err := cfg.NewCollector()
+			if err != nil {
+				t.Fatalf("collector of the flags: %s", err)
+			}
+			if len(c.TestHandlers) != tt.wantHandlers {
+				t.Errorf("%d test handlers, want %d", len(c.TestHandlers), tt.wantHandlers)
+			}
+			if _, ok := c.ProbeModules[thousandeyes.DefaultProbeModule]; ok != tt.wantDefault {
+				t.Errorf("default probe module %t, want %t", ok, tt.wantDefault)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package thousandeyes
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const apiURLAccountGroups = "https://api.thousandeyes.com/v6/account-groups.json"
+
+// AccountGroup of ThousandEyes, the AID is passed as aid parameter to all API requests
+type AccountGroup struct {
+	AID     int    `json:"aid"`
+	Name    string `json:"accountGroupName"`
+	Current int    `json:"current"`
+	Default int    `json:"default"`
+}
+
+// ThousandAccountGroups describes the JSON returned by a request of the account groups the token can access
+type ThousandAccountGroups struct {
+	AccountGroups []AccountGroup `json:"accountGroups"`
+}
+
+// AccountGroupSelection chooses the account groups to scrape
+// nothing set means the default account group of the token only (like ThousandEyes does without aid parameter)
+type AccountGroupSelection struct {
+	All bool
+	// Names holds account group names or aids
+	Names []string
+	Regex *regexp.Regexp
+}
+
+// ParseAccountGroupSelection builds the selection from a comma separated list ("all" or names/aids) and a regex on the name
+func ParseAccountGroupSelection(list string, regex string) (AccountGroupSelection, error) {
+	var s AccountGroupSelection
+
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		switch name {
+		case "":
+		case "all":
+			s.All = true
+		default:
+			s.Names = append(s.Names, name)
+		}
+	}
+
+	if regex != "" {
+		r, err := regexp.Compile(regex)
+		if err != nil {
+			return s, fmt.Errorf("account group regex %q is not valid: %s", regex, err)
+		}
+		s.Regex = r
+	}
+	return s, nil
+}
+
+// IsDefault is true if nothing was chosen, so only the default account group is scraped
+func (s AccountGroupSelection) IsDefault() bool {
+	return !s.All && len(s.Names) == 0 && s.Regex == nil
+}
+
+func (s AccountGroupSelection) matches(ag AccountGroup) bool {
+	if s.IsDefault() {
+		return ag.Default == 1
+	}
+	if s.All {
+		return true
+	}
+	for _, name := range s.Names {
+		if name == ag.Name || name == strconv.Itoa(ag.AID) {
+			return true
+		}
+	}
+	return s.Regex != nil && s.Regex.MatchString(ag.Name)
+}
+
+// accountGroupsCache keeps the selected account groups between refreshes, they rarely change
+type accountGroupsCache struct {
+	mu      sync.Mutex
+	groups  []AccountGroup
+	updated time.Time
+}
+
+// withAccountGroup adds the aid parameter to an API URL
+func withAccountGroup(apiURL string, ag AccountGroup) string {
+	if ag.AID == 0 {
+		return apiURL
+	}
+	u, err := url.Parse(apiURL)
+	if err != nil {
+		return apiURL
+	}
+	q := u.Query()
+	q.Set("aid", strconv.Itoa(ag.AID))
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// GetAccountGroups returns the account groups selected by AccountGroups out of the ones the token can access
+func (t *Collector) GetAccountGroups() (groups []AccountGroup, bHitAPILimit bool, bError bool) {
+
+	all, bHitAPILimit, bError := t.newBackend().getAccountGroups(t)
+	if bError {
+		return groups, bHitAPILimit, bError
+	}
+
+	for _, ag := range all {
+		if t.AccountGroups.matches(ag) {
+			groups = append(groups, ag)
+		}
+	}
+	if len(groups) == 0 {
+		bError = true
+		log.Println("ERROR: No ThousandEyes account group the token can access matches the selection.")
+	}
+	return groups, bHitAPILimit, bError
+}
+
+// cachedAccountGroups returns the account groups fetched within the last AccountGroupsPollInterval and fetches them again otherwise,
+// if that fails the former account groups are used
+// fetcher requests them, so a /probe request fetches them with its own retry budget
+func (t *Collector) cachedAccountGroups(fetcher *Collector) ([]AccountGroup, bool, bool) {
+	c := &t.accountGroupsCache
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.groups != nil && time.Since(c.updated) < t.accountGroupsPollInterval() {
+		return c.groups, false, false
+	}
+
+	groups, bHitAPILimit, bError := fetcher.GetAccountGroups()
+	if bError {
+		if c.groups != nil {
+			log.Println("INFO: ThousandEyes account groups could not be refreshed, the former ones are used.")
+			return c.groups, bHitAPILimit, false
+		}
+		return groups, bHitAPILimit, bError
+	}
+	c.groups = groups
+	c.updated = time.Now()
+	return groups, bHitAPILimit, bError
+}
@@ -0,0 +1,212 @@
+package thousandeyes
+
+import (
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"log"
+	"strings"
+)
+
+// agent-to-agent tests use the net/metrics endpoint like agent-to-server tests, with a result per direction
+
+// agentToAgentTestLabels are the labels of agent-to-agent test metrics, direction is to_target or from_target
+var agentToAgentTestLabels = []string{"test_id", "test_name", "type", "source_agent", "target_agent", "direction", "account_group_id", "account_group_name"}
+
+var (
+	// - agent-to-agent tests
+	ThousandTestAgentToAgentLossDesc = prometheus.NewDesc(
+		"thousandeyes_test_agent_to_agent_loss_percentage",
+		"Agent to agent test ran in ThousandEyes - metric: loss.",
+		agentToAgentTestLabels,
+		nil)
+	ThousandTestAgentToAgentAvgLatencyDesc = prometheus.NewDesc(
+		"thousandeyes_test_agent_to_agent_avg_latency_milliseconds",
+		"Agent to agent test ran in ThousandEyes - metric: avgLatency.",
+		agentToAgentTestLabels,
+		nil)
+	ThousandTestAgentToAgentMinLatencyDesc = prometheus.NewDesc(
+		"thousandeyes_test_agent_to_agent_min_latency_milliseconds",
+		"Agent to agent test ran in ThousandEyes - metric: minLatency.",
+		agentToAgentTestLabels,
+		nil)
+	ThousandTestAgentToAgentMaxLatencyDesc = prometheus.NewDesc(
+		"thousandeyes_test_agent_to_agent_max_latency_milliseconds",
+		"Agent to agent test ran in ThousandEyes - metric: maxLatency.",
+		agentToAgentTestLabels,
+		nil)
+	ThousandTestAgentToAgentJitterDesc = prometheus.NewDesc(
+		"thousandeyes_test_agent_to_agent_jitter_milliseconds",
+		"Agent to agent test ran in ThousandEyes - metric: jitter.",
+		agentToAgentTestLabels,
+		nil)
+	ThousandTestAgentToAgentThroughputDesc = prometheus.NewDesc(
+		"thousandeyes_test_agent_to_agent_throughput_mbps",
+		"Agent to agent test ran in ThousandEyes - metric: throughput, only if throughput measurements are enabled for the test.",
+		agentToAgentTestLabels,
+		nil)
+)
+
+//https://api.thousandeyes.com/v6/net/metrics/612434.json
+
+// AgentToAgentTestResults agent-to-agent test details
+type AgentToAgentTestResults struct {
+	Net struct {
+		Test    ThousandTest         `json:"test"`
+		Metrics []AgentToAgentMetric `json:"metrics"`
+	} `json:"net"`
+	Pages Pages `json:"pages"`
+	// AccountGroup the test belongs to
+	AccountGroup AccountGroup `json:"-"`
+	// TargetAgentName is the name of the target agent of the test, resolved by the agents of the account group
+	TargetAgentName string `json:"-"`
+}
+
+// AgentToAgentMetric network metrics of an agent in one direction, Throughput is only set if enabled for the test
+type AgentToAgentMetric struct {
+	Direction  string   `json:"direction"`
+	AvgLatency float32  `json:"avgLatency"`
+	Loss       float32  `json:"loss"`
+	MaxLatency float32  `json:"maxLatency"`
+	Jitter     float32  `json:"jitter"`
+	MinLatency float32  `json:"minLatency"`
+	Throughput *float32 `json:"throughput,omitempty"`
+	AgentName  string   `json:"agentName"`
+	CountryID  string   `json:"countryId"`
+	AgentID    int      `json:"agentId"`
+}
+
+func (r *AgentToAgentTestResults) nextPage() string { return r.Pages.Next }
+func (r *AgentToAgentTestResults) appendPage(page interface{}) {
+	r.Net.Metrics = append(r.Net.Metrics, page.(*AgentToAgentTestResults).Net.Metrics...)
+}
+
+type v7AgentToAgentResults struct {
+	Test    v7Test `json:"test"`
+	Results []struct {
+		AgentToAgentMetric
+		AgentID string `json:"agentId"`
+	} `json:"results"`
+	Links v7Links `json:"_links"`
+}
+
+func (r *v7AgentToAgentResults) nextPage() string { return r.Links.Next.Href }
+func (r *v7AgentToAgentResults) appendPage(page interface{}) {
+	r.Results = append(r.Results, page.(*v7AgentToAgentResults).Results...)
+}
+
+func (r *v7AgentToAgentResults) result(ctx *TestContext) interface{} {
+	res := new(AgentToAgentTestResults)
+	res.Net.Test = r.Test.toV6()
+	for _, m := range r.Results {
+		metric := m.AgentToAgentMetric
+		metric.AgentID = v7ID(m.AgentID)
+		agent := ctx.v7Agent(m.AgentID)
+		metric.AgentName = agent.AgentName
+		metric.CountryID = agent.CountryID
+		res.Net.Metrics = append(res.Net.Metrics, metric)
+	}
+	return res
+}
+
+// endpoints returns source and target agent and the direction of a metric
+// the agent of the metric is the source of to_target and the target of from_target measurements
+func (r AgentToAgentTestResults) endpoints(m AgentToAgentMetric) (string, string, string) {
+	direction := strings.ToLower(m.Direction)
+	if direction == "from_target" {
+		return r.TargetAgentName, m.AgentName, direction
+	}
+	return m.AgentName, r.TargetAgentName, direction
+}
+
+// newAgentToAgentHandler collects the network metrics of agent-to-agent tests per direction
+func newAgentToAgentHandler() TestHandler {
+	return resultHandler{
+		handlerInfo: handlerInfo{
+			family:    FamilyAgentToAgent,
+			testTypes: []string{"agent-to-agent"},
+			descs: []*prometheus.Desc{
+				ThousandTestAgentToAgentLossDesc,
+				ThousandTestAgentToAgentAvgLatencyDesc,
+				ThousandTestAgentToAgentMinLatencyDesc,
+				ThousandTestAgentToAgentMaxLatencyDesc,
+				ThousandTestAgentToAgentJitterDesc,
+				ThousandTestAgentToAgentThroughputDesc,
+			},
+		},
+		requests: resultRequests{
+			APIVersion6: {apiURLTestHTTPMetrics, func() interface{} { return new(AgentToAgentTestResults) }},
+			APIVersion7: {apiURLv7TestNetwork, func() interface{} { return new(v7AgentToAgentResults) }},
+		},
+		complete: func(ctx *TestContext, result interface{}) {
+			res := result.(*AgentToAgentTestResults)
+			res.TargetAgentName = ctx.agentName(res.Net.Test.TargetAgentID)
+		},
+		collect: collectAgentToAgent,
+	}
+}
+
+func collectAgentToAgent(tA2A []AgentToAgentTestResults, ch chan<- prometheus.Metric) {
+
+	for e := range tA2A {
+		if len(tA2A[e].Net.Metrics) == 0 {
+			log.Println("INFO: Agent to agent metrics are empty for Test:", tA2A[e])
+			continue
+		}
+		test := tA2A[e].Net.Test
+		ag := tA2A[e].AccountGroup
+
+		for _, m := range tA2A[e].Net.Metrics {
+
+			source, target, direction := tA2A[e].endpoints(m)
+			labels := []string{
+				fmt.Sprintf("%d", test.TestID),
+				test.TestName,
+				test.Type,
+				source,
+				target,
+				direction,
+				fmt.Sprintf("%d", ag.AID),
+				ag.Name,
+			}
+
+			ch <- prometheus.MustNewConstMetric(
+				ThousandTestAgentToAgentLossDesc,
+				prometheus.GaugeValue,
+				float64(m.Loss),
+				labels...,
+			)
+			ch <- prometheus.MustNewConstMetric(
+				ThousandTestAgentToAgentAvgLatencyDesc,
+				prometheus.GaugeValue,
+				float64(m.AvgLatency),
+				labels...,
+			)
+			ch <- prometheus.MustNewConstMetric(
+				ThousandTestAgentToAgentMinLatencyDesc,
+				prometheus.GaugeValue,
+				float64(m.MinLatency),
+				labels...,
+			)
+			ch <- prometheus.MustNewConstMetric(
+				ThousandTestAgentToAgentMaxLatencyDesc,
+				prometheus.GaugeValue,
+				float64(m.MaxLatency),
+				labels...,
+			)
+			ch <- prometheus.MustNewConstMetric(
+				ThousandTestAgentToAgentJitterDesc,
+				prometheus.GaugeValue,
+				float64(m.Jitter),
+				labels...,
+			)
+			if m.Throughput != nil {
+				ch <- prometheus.MustNewConstMetric(
+					ThousandTestAgentToAgentThroughputDesc,
+					prometheus.GaugeValue,
+					float64(*m.Throughput),
+					labels...,
+				)
+			}
+		}
+	}
+}
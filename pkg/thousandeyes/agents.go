@@ -0,0 +1,169 @@
+package thousandeyes
+
+import (
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"sort"
+	"strings"
+	"time"
+)
+
+const apiURLAgents = "https://api.thousandeyes.com/v6/agents.json"
+
+// agentLabels are the labels of all agent series
+var agentLabels = []string{"agent_id", "agent_name", "agent_type", "account_group_id", "account_group_name"}
+
+var (
+	// - agents
+	ThousandAgentInfoDesc = prometheus.NewDesc(
+		"thousandeyes_agent_info",
+		"Agent of the account group in ThousandEyes - always 1, the details are labels. The version is empty if the API does not list it (v6).",
+		append(append([]string{}, agentLabels...), "location", "country", "ip_addresses", "public_ip_addresses", "version"),
+		nil)
+	ThousandAgentUpDesc = prometheus.NewDesc(
+		"thousandeyes_agent_up",
+		"Agent of the account group in ThousandEyes - 1 if the agent is online, 0 if it is offline or disabled. Only enterprise agents report a state.",
+		agentLabels,
+		nil)
+	ThousandAgentLastSeenDesc = prometheus.NewDesc(
+		"thousandeyes_agent_last_seen_timestamp_seconds",
+		"Agent of the account group in ThousandEyes - time the agent was last seen by ThousandEyes.",
+		agentLabels,
+		nil)
+	ThousandAgentUtilizationDesc = prometheus.NewDesc(
+		"thousandeyes_agent_utilization_percentage",
+		"Agent of the account group in ThousandEyes - share of the capacity of the agent used by its tests. Only enterprise agents report it.",
+		agentLabels,
+		nil)
+)
+
+//https://api.thousandeyes.com/v6/agents.json
+
+// ThousandAgents describes the JSON returned by a request of the agents of an account group
+type ThousandAgents struct {
+	Agents []ThousandAgent `json:"agents"`
+	Pages  Pages           `json:"pages"`
+	// AccountGroup the agents were requested for
+	AccountGroup AccountGroup `json:"-"`
+	// Timezone of the dates of the account, see parseThousandDate
+	Timezone *time.Location `json:"-"`
+}
+
+// ThousandAgent is a cloud or enterprise agent, state, last seen and utilization are set for enterprise agents only
+type ThousandAgent struct {
+	AgentID           int      `json:"agentId"`
+	AgentName         string   `json:"agentName"`
+	AgentType         string   `json:"agentType"`
+	CountryID         string   `json:"countryId"`
+	Location          string   `json:"location"`
+	IPAddresses       []string `json:"ipAddresses"`
+	PublicIPAddresses []string `json:"publicIpAddresses"`
+	AgentState        string   `json:"agentState"`
+	LastSeen          string   `json:"lastSeen"`
+	Utilization       int      `json:"utilization"`
+	// Version is listed by the v7 agents only
+	Version string `json:"-"`
+}
+
+func (a *ThousandAgents) nextPage() string { return a.Pages.Next }
+func (a *ThousandAgents) appendPage(page interface{}) {
+	a.Agents = append(a.Agents, page.(*ThousandAgents).Agents...)
+}
+
+// byID maps agent ids to agents
+func (a ThousandAgents) byID() map[int]ThousandAgent {
+	agents := map[int]ThousandAgent{}
+	for _, agent := range a.Agents {
+		agents[agent.AgentID] = agent
+	}
+	return agents
+}
+
+// GetAgents returns the agents of the account group ordered by id
+func (t *Collector) GetAgents(ag AccountGroup) (ThousandAgents, bool, bool) {
+	agents := ThousandAgents{AccountGroup: ag, Timezone: t.timezone()}
+
+	byID, bHitAPILimit, bError := t.newBackend().getAgents(t, ag)
+	for _, a := range byID {
+		agents.Agents = append(agents.Agents, a)
+	}
+	sort.Slice(agents.Agents, func(i, j int) bool { return agents.Agents[i].AgentID < agents.Agents[j].AgentID })
+	return agents, bHitAPILimit, bError
+}
+
+// parseThousandDate parses the dates of the API, RFC 3339 (v7) or "2006-01-02 15:04:05" in the timezone of the account (v6)
+func parseThousandDate(date string, loc *time.Location) (time.Time, bool) {
+	if d, err := time.Parse(time.RFC3339, date); err == nil {
+		return d, true
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+	d, err := time.ParseInLocation("2006-01-02 15:04:05", date, loc)
+	return d, err == nil
+}
+
+// timezone is the timezone of the account the v6 dates are given in, UTC if not set
+func (t *Collector) timezone() *time.Location {
+	if t.Timezone == nil {
+		return time.UTC
+	}
+	return t.Timezone
+}
+
+func collectAgents(tAgents ThousandAgents, ch chan<- prometheus.Metric) {
+
+	ag := tAgents.AccountGroup
+	for _, a := range tAgents.Agents {
+
+		labels := []string{
+			fmt.Sprintf("%d", a.AgentID),
+			a.AgentName,
+			a.AgentType,
+			fmt.Sprintf("%d", ag.AID),
+			ag.Name,
+		}
+
+		ch <- prometheus.MustNewConstMetric(
+			ThousandAgentInfoDesc,
+			prometheus.GaugeValue,
+			1,
+			append(append([]string{}, labels...),
+				a.Location,
+				a.CountryID,
+				strings.Join(a.IPAddresses, ","),
+				strings.Join(a.PublicIPAddresses, ","),
+				a.Version,
+			)...,
+		)
+
+		// cloud agents are run by ThousandEyes and report neither state nor utilization
+		if a.AgentState == "" {
+			continue
+		}
+		up := 0.0
+		if a.AgentState == "Online" {
+			up = 1
+		}
+		ch <- prometheus.MustNewConstMetric(
+			ThousandAgentUpDesc,
+			prometheus.GaugeValue,
+			up,
+			labels...,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			ThousandAgentUtilizationDesc,
+			prometheus.GaugeValue,
+			float64(a.Utilization),
+			labels...,
+		)
+		if lastSeen, ok := parseThousandDate(a.LastSeen, tAgents.Timezone); ok {
+			ch <- prometheus.MustNewConstMetric(
+				ThousandAgentLastSeenDesc,
+				prometheus.GaugeValue,
+				float64(lastSeen.Unix()),
+				labels...,
+			)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package thousandeyes
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestParseThousandDate(t *testing.T) {
+	// a fixed zone, so the test does not depend on the tz database of the host
+	berlin := time.FixedZone("CEST", 2*60*60)
+
+	tests := []struct {
+		name   string
+		date   string
+		loc    *time.Location
+		want   time.Time
+		wantOK bool
+	}{
+		{"v6 date in the account timezone", "2020-06-01 12:00:00", berlin, time.Date(2020, 6, 1, 10, 0, 0, 0, time.UTC), true},
+		{"v6 date without timezone is UTC", "2020-06-01 12:00:00", nil, time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC), true},
+		{"v7 date ignores the account timezone", "2020-06-01T12:00:00Z", berlin, time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC), true},
+		{"v7 date with offset", "2020-06-01T12:00:00+02:00", nil, time.Date(2020, 6, 1, 10, 0, 0, 0, time.UTC), true},
+		{"empty", "", berlin, time.Time{}, false},
+		{"not a date", "yesterday", berlin, time.Time{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseThousandDate(tt.date, tt.loc)
+			if ok != tt.wantOK {
+				t.Fatalf("parsed %t, want %t", ok, tt.wantOK)
+			}
+			if ok && !got.Equal(tt.want) {
+				t.Errorf("date %s, want %s", got.UTC(), tt.want)
+			}
+		})
+	}
+}
+
+func TestCollectAgentsVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		version string
+	}{
+		{"listed by the API (v7)", "1.140.0"},
+		{"not listed by the API (v6)", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			agents := ThousandAgents{Agents: []ThousandAgent{{AgentID: 1, AgentName: "Frankfurt", Version: tt.version}}}
+
+			registry := prometheus.NewRegistry()
+			registry.MustRegister(collectorFunc(func(ch chan<- prometheus.Metric) { collectAgents(agents, ch) }))
+			families, err := registry.Gather()
+			if err != nil {
+				t.Fatalf("gather: %s", err)
+			}
+			if len(families) != 1 || families[0].GetName() != "thousandeyes_agent_info" {
+				t.Fatalf("metrics %v, want thousandeyes_agent_info only", families)
+			}
+
+			version, ok := "", false
+			for _, l := range families[0].GetMetric()[0].GetLabel() {
+				if l.GetName() == "version" {
+					version, ok = l.GetValue(), true
+				}
+			}
+			if !ok || version != tt.version {
+				t.Errorf("version %q (label present %t), want %q", version, ok, tt.version)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package thousandeyes
+
+import (
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// alertLabels identify the alert of the agent and monitor series, alert_id joins them with thousandeyes_alert_start_timestamp_seconds
+var alertLabels = []string{"alert_id", "test_name", "type", "rule_name"}
+
+var (
+	// - agents and monitors of alerts, the API v6 only lists them
+	ThousandAlertAgentDesc = prometheus.NewDesc(
+		"thousandeyes_alert_agent",
+		"Agent of a triggered alert in ThousandEyes - 1 while the agent violates the rule, 0 if it did since the alert started.",
+		append(append([]string{}, alertLabels...), "agent_id", "agent_name", "account_group_id", "account_group_name"),
+		nil)
+	ThousandAlertAgentInfoDesc = prometheus.NewDesc(
+		"thousandeyes_alert_agent_info",
+		"Agent of a triggered alert in ThousandEyes - always 1, the metrics of the agent at the start and the end of the violation are labels.",
+		append(append([]string{}, alertLabels...), "agent_id", "agent_name", "metrics_at_start", "metrics_at_end", "account_group_id", "account_group_name"),
+		nil)
+	ThousandAlertMonitorDesc = prometheus.NewDesc(
+		"thousandeyes_alert_monitor",
+		"BGP monitor of a triggered alert in ThousandEyes - 1 while the monitor violates the rule for the prefix, 0 if it did since the alert started.",
+		append(append([]string{}, alertLabels...), "monitor_id", "monitor_name", "prefix", "network", "account_group_id", "account_group_name"),
+		nil)
+	ThousandAlertMonitorInfoDesc = prometheus.NewDesc(
+		"thousandeyes_alert_monitor_info",
+		"BGP monitor of a triggered alert in ThousandEyes - always 1, the metrics of the monitor at the start and the end of the violation are labels.",
+		append(append([]string{}, alertLabels...), "monitor_id", "monitor_name", "prefix", "network", "metrics_at_start", "metrics_at_end", "account_group_id", "account_group_name"),
+		nil)
+)
+
+// collectAlertBreakdown shows which agents and monitors violate the rule of the alert
+func collectAlertBreakdown(a ThousandAlert, ag AccountGroup, ch chan<- prometheus.Metric) {
+
+	alert := []string{
+		fmt.Sprintf("%d", a.AlertID),
+		a.TestName,
+		a.Type,
+		a.RuleName,
+	}
+	accountGroup := []string{
+		fmt.Sprintf("%d", ag.AID),
+		ag.Name,
+	}
+
+	for _, agent := range a.Agents {
+		labels := append(append([]string{}, alert...), fmt.Sprintf("%d", agent.AgentID), agent.AgentName)
+
+		ch <- prometheus.MustNewConstMetric(
+			ThousandAlertAgentDesc,
+			prometheus.GaugeValue,
+			float64(agent.Active),
+			append(append([]string{}, labels...), accountGroup...)...,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			ThousandAlertAgentInfoDesc,
+			prometheus.GaugeValue,
+			1,
+			append(append(append([]string{}, labels...), agent.MetricsAtStart, agent.MetricsAtEnd), accountGroup...)...,
+		)
+	}
+
+	for _, m := range a.Monitors {
+		labels := append(append([]string{}, alert...), fmt.Sprintf("%d", m.MonitorID), m.MonitorName, m.Prefix, m.Network)
+
+		ch <- prometheus.MustNewConstMetric(
+			ThousandAlertMonitorDesc,
+			prometheus.GaugeValue,
+			float64(m.Active),
+			append(append([]string{}, labels...), accountGroup...)...,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			ThousandAlertMonitorInfoDesc,
+			prometheus.GaugeValue,
+			1,
+			append(append(append([]string{}, labels...), m.MetricsAtStart, m.MetricsAtEnd), accountGroup...)...,
+		)
+	}
+}
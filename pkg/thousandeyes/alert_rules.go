@@ -0,0 +1,118 @@
+package thousandeyes
+
+import (
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const apiURLAlertRules = "https://api.thousandeyes.com/v6/alert-rules.json"
+
+var (
+	// - alert rules, all rules - thousandeyes_alert only shows the rules firing
+	ThousandAlertRuleInfoDesc = prometheus.NewDesc(
+		"thousandeyes_alert_rule_info",
+		"Alert rule of the account group in ThousandEyes - always 1, the details are labels. enabled is true for rules assigned to at least one test (the API has no enabled flag), default is true for the rules ThousandEyes assigns to new tests.",
+		[]string{"rule_id", "rule_name", "expression", "severity", "alert_type", "enabled", "default", "account_group_id", "account_group_name"},
+		nil)
+	ThousandAlertRuleTestDesc = prometheus.NewDesc(
+		"thousandeyes_alert_rule_test",
+		"Alert rule of the account group in ThousandEyes - always 1, one series per test the rule is assigned to.",
+		[]string{"rule_id", "rule_name", "test_id", "test_name", "account_group_id", "account_group_name"},
+		nil)
+)
+
+//https://api.thousandeyes.com/v6/alert-rules.json
+
+// ThousandAlertRules describes the JSON returned by a request of the alert rules of an account group
+type ThousandAlertRules struct {
+	AlertRules []ThousandAlertRule `json:"alertRules"`
+	Pages      Pages               `json:"pages"`
+	// AccountGroup the alert rules were requested for
+	AccountGroup AccountGroup `json:"-"`
+}
+
+// ThousandAlertRule is an alert rule, Tests are the tests of TestIDs with their names
+type ThousandAlertRule struct {
+	RuleID     int    `json:"ruleId"`
+	RuleName   string `json:"ruleName"`
+	Expression string `json:"expression"`
+	AlertType  string `json:"alertType"`
+	Severity   string `json:"severity"`
+	Default    int    `json:"default"`
+	TestIDs    []int  `json:"testIds"`
+
+	Tests []AlertRuleTest `json:"-"`
+}
+
+// AlertRuleTest is a test an alert rule is assigned to
+type AlertRuleTest struct {
+	TestID   int
+	TestName string
+}
+
+func (r *ThousandAlertRules) nextPage() string { return r.Pages.Next }
+func (r *ThousandAlertRules) appendPage(page interface{}) {
+	r.AlertRules = append(r.AlertRules, page.(*ThousandAlertRules).AlertRules...)
+}
+
+// enabled is true if the rule is assigned to a test, only then it can fire - the API has no enabled flag for alert rules
+func (r ThousandAlertRule) enabled() bool {
+	return len(r.Tests) > 0
+}
+
+// GetAlertRules returns the alert rules of the account group with the tests they are assigned to
+func (t *Collector) GetAlertRules(ag AccountGroup) (ThousandAlertRules, bool, bool) {
+
+	rules, bHitAPILimit, bError := t.newBackend().getAlertRules(t, ag)
+	rules.AccountGroup = ag
+	return rules, bHitAPILimit, bError
+}
+
+// alertRuleTests resolves the test ids of the v6 alert rules by the tests of the account group
+func alertRuleTests(rules []ThousandAlertRule, tests []ThousandTest) {
+	names := map[int]string{}
+	for _, test := range tests {
+		names[test.TestID] = test.TestName
+	}
+	for i := range rules {
+		for _, id := range rules[i].TestIDs {
+			rules[i].Tests = append(rules[i].Tests, AlertRuleTest{TestID: id, TestName: names[id]})
+		}
+	}
+}
+
+func collectAlertRules(tRules ThousandAlertRules, ch chan<- prometheus.Metric) {
+
+	ag := tRules.AccountGroup
+	for _, r := range tRules.AlertRules {
+
+		ch <- prometheus.MustNewConstMetric(
+			ThousandAlertRuleInfoDesc,
+			prometheus.GaugeValue,
+			1,
+			fmt.Sprintf("%d", r.RuleID),
+			r.RuleName,
+			r.Expression,
+			r.Severity,
+			r.AlertType,
+			fmt.Sprintf("%t", r.enabled()),
+			fmt.Sprintf("%t", r.Default == 1),
+			fmt.Sprintf("%d", ag.AID),
+			ag.Name,
+		)
+
+		for _, test := range r.Tests {
+			ch <- prometheus.MustNewConstMetric(
+				ThousandAlertRuleTestDesc,
+				prometheus.GaugeValue,
+				1,
+				fmt.Sprintf("%d", r.RuleID),
+				r.RuleName,
+				fmt.Sprintf("%d", test.TestID),
+				test.TestName,
+				fmt.Sprintf("%d", ag.AID),
+				ag.Name,
+			)
+		}
+	}
+}
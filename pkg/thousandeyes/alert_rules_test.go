@@ -0,0 +1,46 @@
+package thousandeyes
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestCollectAlertRulesEnabled(t *testing.T) {
+	tests := []struct {
+		name        string
+		rule        ThousandAlertRule
+		wantEnabled string
+		wantDefault string
+	}{
+		{"assigned", ThousandAlertRule{RuleID: 1, Tests: []AlertRuleTest{{TestID: 7}}}, "true", "false"},
+		{"not assigned", ThousandAlertRule{RuleID: 2}, "false", "false"},
+		{"default, not assigned yet", ThousandAlertRule{RuleID: 3, Default: 1}, "false", "true"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := ThousandAlertRules{AlertRules: []ThousandAlertRule{tt.rule}}
+
+			registry := prometheus.NewRegistry()
+			registry.MustRegister(collectorFunc(func(ch chan<- prometheus.Metric) { collectAlertRules(rules, ch) }))
+			families, err := registry.Gather()
+			if err != nil {
+				t.Fatalf("gather: %s", err)
+			}
+
+			labels := map[string]string{}
+			for _, f := range families {
+				if f.GetName() != "thousandeyes_alert_rule_info" {
+					continue
+				}
+				for _, l := range f.GetMetric()[0].GetLabel() {
+					labels[l.GetName()] = l.GetValue()
+				}
+			}
+			if labels["enabled"] != tt.wantEnabled || labels["default"] != tt.wantDefault {
+				t.Errorf("enabled %q default %q, want %q %q", labels["enabled"], labels["default"], tt.wantEnabled, tt.wantDefault)
+			}
+		})
+	}
+}
@@ -8,20 +8,115 @@ import (
 	"io/ioutil"
 	"log"
 	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 )
 
+// maxRateLimitWaits is the number of times a request waits for the rate limit reset after a 429, before it gives up
+const maxRateLimitWaits = 3
+
+// DefaultMaxPages is the safety cap of pages fetched for one paginated request, if max_pages is not configured
+const DefaultMaxPages = 100
+
+// resolvePageURL makes the next page link absolute (ThousandEyes sends absolute links, but who knows)
+func resolvePageURL(current string, next string) (string, error) {
+	base, err := url.Parse(current)
+	if err != nil {
+		return "", err
+	}
+	ref, err := url.Parse(next)
+	if err != nil {
+		return "", err
+	}
+	return base.ResolveReference(ref).String(), nil
+}
+
+// endpointName is the URL path with the IDs replaced, so it can be used as a label: /v6/net/metrics/{id}.json
+func endpointName(u *url.URL) string {
+	segments := strings.Split(u.Path, "/")
+	for i, segment := range segments {
+		id := strings.TrimSuffix(segment, ".json")
+		if _, err := strconv.Atoi(id); err == nil {
+			segments[i] = strings.Replace(segment, id, "{id}", 1)
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
 
 // CallSingle is a single URL call
+// if the response object is paginated, all following pages (up to maxPages, DefaultMaxPages if <= 0) are fetched and appended to it
+// transient failures are retried as long as budget allows
 // it returns true, if the API Rate Limit was hit
 // the error & result object itself are modified in the Request struct
-func CallSingle(token string, user string, isBasicAuth bool, request *Request) (bHitAPILimit bool, bError bool) {
-	ThousandRequestsTotalMetric.Inc()
-	client := &http.Client{}
+func CallSingle(token string, user string, isBasicAuth bool, maxPages int, budget *RetryBudget, request *Request) (bHitAPILimit bool, bError bool) {
+
+	if maxPages <= 0 {
+		maxPages = DefaultMaxPages
+	}
+
+	bHitAPILimit, bError = callPage(token, user, isBasicAuth, budget, request)
+	paged, ok := request.ResponseObject.(pagedResponse)
+	if bError || !ok {
+		return
+	}
+
+	next := paged.nextPage()
+	for pages := 1; next != ""; pages++ {
+		if pages >= maxPages {
+			if u, err := url.Parse(request.URL); err == nil {
+				ThousandAPIPagesTruncatedMetric.WithLabelValues(endpointName(u)).Inc()
+			}
+			log.Printf("ERROR: Stopped paging after %d pages (max_pages), the rest is skipped (url: %s)", pages, request.URL)
+			return
+		}
+
+		nextURL, err := resolvePageURL(request.URL, next)
+		if err != nil {
+			bError = true
+			request.Error = fmt.Errorf("ThousandEyes API next page link not valid: %s (url: %s)", err, request.URL)
+			log.Printf("ERROR: %s", request.Error)
+			return
+		}
+
+		page := Request{
+			URL:            nextURL,
+			ResponseObject: reflect.New(reflect.TypeOf(request.ResponseObject).Elem()).Interface(),
+		}
+		bHitAPILimit, bError = callPage(token, user, isBasicAuth, budget, &page)
+		if bError {
+			request.Error = page.Error
+			return
+		}
+
+		paged.appendPage(page.ResponseObject)
+		next = page.ResponseObject.(pagedResponse).nextPage()
+	}
+
+	return
+}
+
+// callPage is a single URL call
+// every call waits for its turn in the APIRateLimiter, on a 429 it waits until the rate limit window resets and tries again
+// transient failures (5xx, timeouts, connection resets) are retried according to APIRetryPolicy while budget allows
+// it returns true, if the API Rate Limit was still hit after maxRateLimitWaits
+// the error & result object itself are modified in the Request struct
+func callPage(token string, user string, isBasicAuth bool, budget *RetryBudget, request *Request) (bHitAPILimit bool, bError bool) {
+	client := &http.Client{Timeout: APIRequestTimeout}
 	bHitAPILimit = false
 	bError = false
 
 	req, err := http.NewRequest("GET", request.URL, nil)
+	if err != nil {
+		bError = true
+		request.Error = fmt.Errorf("ThousandEyes API Request could not be created: %s (url: %s)", err, request.URL)
+		log.Printf("ERROR: %s", request.Error)
+		return
+	}
 	if isBasicAuth {
 		//bt, _ := base64.StdEncoding.DecodeString(token)
 		req.SetBasicAuth(user,token)
@@ -32,26 +127,70 @@ func CallSingle(token string, user string, isBasicAuth bool, request *Request) (
 	}
 	req.Header.Add("Content-Type", "application/json")
 
-	//log.Println(fmt.Sprintf("CALL >>> Url: %s", request.URL))
-	resp, err := client.Do(req)
-	if resp.StatusCode == 429 {
-		bHitAPILimit = true
+	var resp *http.Response
+	for waits, attempt := 0, 0; ; {
+		APIRateLimiter.Wait()
+		ThousandRequestsTotalMetric.Inc()
+
+		//log.Println(fmt.Sprintf("CALL >>> Url: %s", request.URL))
+		resp, err = client.Do(req)
+		if err == nil && resp.StatusCode == http.StatusTooManyRequests {
+			resp.Body.Close()
+
+			reset := APIRateLimiter.BlockUntilReset(resp.Header)
+			if waits >= maxRateLimitWaits {
+				bHitAPILimit = true
+				bError = true
+				ThousandAPIFailuresMetric.WithLabelValues(failureCode(resp, err)).Inc()
+				request.Error = fmt.Errorf("ThousandEyes API Rate Limit hit (\"Too many requests\") %d times - http code: %d (url: %s)", waits+1, resp.StatusCode, req.URL)
+				log.Printf("ERROR: %s", request.Error)
+				return
+			}
+			waits++
+			log.Printf("INFO: ThousandEyes API Rate Limit hit, waiting until %s (url: %s)", reset.Format(time.RFC3339), req.URL)
+			continue
+		}
+
+		if (err == nil && resp.StatusCode < 500) ||
+			!isRetryable(resp, err) ||
+			attempt+1 >= APIRetryPolicy.MaxAttempts ||
+			!budget.take() {
+			break
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+
+		code := failureCode(resp, err)
+		ThousandAPIRetriesMetric.WithLabelValues(code).Inc()
+		backoff := APIRetryPolicy.backoff(attempt)
+		attempt++
+		log.Printf("INFO: ThousandEyes API Request failed (%s), retry %d in %s (url: %s)", code, attempt, backoff, req.URL)
+		time.Sleep(backoff)
+	}
+	if err != nil {
 		bError = true
-		request.Error = fmt.Errorf("ThousandEyes API Rate Limit hit (\"Too many requests\") - http code: %d", resp.StatusCode)
+		ThousandAPIFailuresMetric.WithLabelValues(failureCode(resp, err)).Inc()
+		request.Error = fmt.Errorf("ThousandEyes API Request failed: %s (url: %s)", err, req.URL)
+		log.Printf("ERROR: %s", request.Error)
 		return
-	} else if err != nil || resp.StatusCode != 200 {
+	}
+	defer resp.Body.Close()
+	APIRateLimiter.Update(resp.Header)
+
+	request.ResponseCode = resp.StatusCode
+	if resp.StatusCode != 200 {
 		bError = true
-		if err == nil {
-			err = errors.New(resp.Status)
-		}
-		request.Error = fmt.Errorf("ThousandEyes API Request failed: %s / http code: %d (url: %s)", err, resp.StatusCode, req.URL)
+		ThousandAPIFailuresMetric.WithLabelValues(failureCode(resp, err)).Inc()
+		request.Error = fmt.Errorf("ThousandEyes API Request failed: %s / http code: %d, %s (url: %s)", errors.New(resp.Status), resp.StatusCode, failureHint(resp.StatusCode), req.URL)
 		log.Printf("ERROR: %s", request.Error)
 		return
 	}
-	defer resp.Body.Close()
+	ThousandAPIPagesMetric.WithLabelValues(endpointName(req.URL)).Inc()
 	responseData, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		bError = true
+		ThousandAPIFailuresMetric.WithLabelValues(failureCode(resp, err)).Inc()
 		request.Error = err
 		return
 	}
@@ -59,6 +198,7 @@ func CallSingle(token string, user string, isBasicAuth bool, request *Request) (
 	err = json.Unmarshal(responseData, request.ResponseObject)
 	if err != nil {
 		bError = true
+		ThousandAPIFailuresMetric.WithLabelValues("invalid_response").Inc()
 		log.Println(err.Error())
 		request.Error = fmt.Errorf("ThousandEyes API Request Unmarshal failed: %s", err.Error())
 	}
@@ -69,13 +209,13 @@ func CallSingle(token string, user string, isBasicAuth bool, request *Request) (
 // CallSequence does CallSingle calls one after the other
 // it returns true, if the API Rate Limit was hit
 // the error & result object itself are modified in the Request struct
-func CallSequence(token string, user string, isBasicAuth bool, requests []Request) (bHitAPILimit bool, bError bool) {
+func CallSequence(token string, user string, isBasicAuth bool, maxPages int, budget *RetryBudget, requests []Request) (bHitAPILimit bool, bError bool) {
 
 	bHitAPILimit = false
 
 	for c := range requests {
 
-		bHitAPILimit, bError = CallSingle(token, user, isBasicAuth, &requests[c])
+		bHitAPILimit, bError = CallSingle(token, user, isBasicAuth, maxPages, budget, &requests[c])
 
 		if bHitAPILimit {
 			return
@@ -85,45 +225,44 @@ func CallSequence(token string, user string, isBasicAuth bool, requests []Reques
 	return
 }
 
-// CallParallel does CallSingle calls in parallel - can hit thousandeyes api restrictions easily
+// CallParallel does CallSingle calls in parallel - they are paced by the shared APIRateLimiter
+// not more than maxParallel calls run at the same time (no limit if <= 0)
 // it returns true, if the API Rate Limit was hit
 // the error & result object itself are modified in the Request struct
-func CallParallel(token string, user string, isBasicAuth bool, requests []Request) (bHitRateLimit bool, bError bool) {
+func CallParallel(token string, user string, isBasicAuth bool, maxParallel int, maxPages int, budget *RetryBudget, requests []Request) (bHitRateLimit bool, bError bool) {
 
 	var waitGroup sync.WaitGroup
 	var m sync.Mutex
 
-	httpChan := make(chan Request, len(requests))
+	if maxParallel <= 0 {
+		maxParallel = len(requests)
+	}
+	slots := make(chan struct{}, maxParallel)
+
 	bHitRateLimit = false;
 
-	for _, request := range requests {
+	for c := range requests {
 
-		//log.Println(fmt.Sprintf("Count [%d] - URL: %s", c, request.URL))
+		//log.Println(fmt.Sprintf("Count [%d] - URL: %s", c, requests[c].URL))
 
 		waitGroup.Add(1)
 
-		go func(token string, user string, isBasicAuth bool, request Request, httpChan chan Request, m *sync.Mutex) {
+		// every call works on its own element of requests, so the caller sees error and response code
+		go func(request *Request) {
 			defer waitGroup.Done()
 
-			//log.Println(fmt.Sprintf("URL: %s | API-Request-Limit-Hit ?: %t", request.URL, b))
+			slots <- struct{}{}
+			defer func() { <-slots }()
 
-			bL, bE := CallSingle(token, user, isBasicAuth, &request)
+			bL, bE := CallSingle(token, user, isBasicAuth, maxPages, budget, request)
 			m.Lock()
 			bHitRateLimit = bHitRateLimit || bL
 			bError = bError || bE
 			m.Unlock()
 
-			if bHitRateLimit {
-				log.Println(fmt.Sprintf("ERROR: Skip Detail request (%s), bcz we hit the API Request Limit.", request.URL))
-				return
-			}
-
-			httpChan <- request
-
-		}(token, user, isBasicAuth, request, httpChan, &m)
+		}(&requests[c])
 	}
 
 	waitGroup.Wait()
-	close(httpChan)
 	return
 }
@@ -0,0 +1,141 @@
+package thousandeyes
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// newTestAPI serves the JSON bodies by path, paths not in bodies are answered with 404
+func newTestAPI(t *testing.T, bodies map[string]string) *httptest.Server {
+	t.Helper()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := bodies[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(strings.Replace(body, "{{server}}", "http://"+r.Host, -1)))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+type roundTripFunc func(r *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+// redirectAPI sends the requests to the ThousandEyes API to s until the test ends
+func redirectAPI(t *testing.T, s *httptest.Server) {
+	t.Helper()
+	target, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	transport := http.DefaultTransport
+	http.DefaultTransport = roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		r = r.Clone(r.Context())
+		r.URL.Scheme = target.Scheme
+		r.URL.Host = target.Host
+		return transport.RoundTrip(r)
+	})
+	t.Cleanup(func() { http.DefaultTransport = transport })
+}
+
+func TestCallParallelReportsErrorsPerRequest(t *testing.T) {
+	s := newTestAPI(t, map[string]string{
+		"/ok/1.json": `{"test": [{"testId": 1}]}`,
+		"/ok/2.json": `{"test": [{"testId": 2}]}`,
+	})
+
+	tests := []struct {
+		path      string
+		wantError bool
+		wantCode  int
+	}{
+		{"/ok/1.json", false, 200},
+		{"/missing/3.json", true, 404},
+		{"/ok/2.json", false, 200},
+	}
+
+	var requests []Request
+	for _, tt := range tests {
+		requests = append(requests, Request{URL: s.URL + tt.path, ResponseObject: new(ThousandTests)})
+	}
+	_, bError := CallParallel("token", "", false, 2, 0, nil, requests)
+	if !bError {
+		t.Errorf("CallParallel: no error reported, one request failed")
+	}
+
+	for i, tt := range tests {
+		r := requests[i]
+		if (r.Error != nil) != tt.wantError {
+			t.Errorf("%s: error %v, want error %t", tt.path, r.Error, tt.wantError)
+		}
+		if r.ResponseCode != tt.wantCode {
+			t.Errorf("%s: response code %d, want %d", tt.path, r.ResponseCode, tt.wantCode)
+		}
+		if !tt.wantError {
+			id := fmt.Sprintf("%d", r.ResponseObject.(*ThousandTests).Tests[0].TestID)
+			if !strings.HasSuffix(tt.path, "/"+id+".json") {
+				t.Errorf("%s: response of test %s", tt.path, id)
+			}
+		}
+	}
+}
+
+func TestCallSingleFollowsPages(t *testing.T) {
+	s := newTestAPI(t, map[string]string{
+		"/v6/agents.json":   `{"agents": [{"agentId": 1}], "pages": {"current": 1, "next": "{{server}}/v6/agents.json/2"}}`,
+		"/v6/agents.json/2": `{"agents": [{"agentId": 2}], "pages": {"current": 2, "next": "/v6/agents.json/3"}}`,
+		"/v6/agents.json/3": `{"agents": [{"agentId": 3}], "pages": {"current": 3}}`,
+		"/v6/broken.json":   `{"agents": [{"agentId": 1}], "pages": {"current": 1, "next": "{{server}}/v6/broken.json/2"}}`,
+	})
+
+	tests := []struct {
+		name          string
+		path          string
+		maxPages      int
+		wantAgents    []int
+		wantError     bool
+		wantTruncated float64
+	}{
+		{"all pages, absolute and relative links", "/v6/agents.json", 100, []int{1, 2, 3}, false, 0},
+		{"cut at max_pages", "/v6/agents.json", 2, []int{1, 2}, false, 1},
+		{"max_pages not set", "/v6/agents.json", 0, []int{1, 2, 3}, false, 0},
+		{"single page", "/v6/agents.json/3", 100, []int{3}, false, 0},
+		{"missing page", "/v6/broken.json", 100, nil, true, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			truncated := ThousandAPIPagesTruncatedMetric.WithLabelValues("/v6/agents.json")
+			before := testutil.ToFloat64(truncated)
+
+			r := Request{URL: s.URL + tt.path, ResponseObject: new(ThousandAgents)}
+			_, bError := CallSingle("token", "", false, tt.maxPages, nil, &r)
+			if bError != tt.wantError || (r.Error != nil) != tt.wantError {
+				t.Fatalf("error %t (%v), want error %t", bError, r.Error, tt.wantError)
+			}
+			if tt.wantError {
+				return
+			}
+
+			var got []int
+			for _, a := range r.ResponseObject.(*ThousandAgents).Agents {
+				got = append(got, a.AgentID)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.wantAgents) {
+				t.Errorf("agents %v, want %v", got, tt.wantAgents)
+			}
+			if d := testutil.ToFloat64(truncated) - before; d != tt.wantTruncated {
+				t.Errorf("truncated %v, want %v", d, tt.wantTruncated)
+			}
+		})
+	}
+}
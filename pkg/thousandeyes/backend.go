@@ -0,0 +1,101 @@
+package thousandeyes
+
+import (
+	"fmt"
+)
+
+// API versions of ThousandEyes usable as backend
+const (
+	APIVersion6 = "v6"
+	APIVersion7 = "v7"
+)
+
+// backend is one version of the ThousandEyes API
+// it hands out the v6 objects the metrics are built from, so metric names and labels do not depend on the API version in use
+// the test results are requested by the TestHandlers, which know the URLs of both versions
+type backend interface {
+	// getAccountGroups returns all account groups the token can access
+	getAccountGroups(t *Collector) ([]AccountGroup, bool, bool)
+	getAlerts(t *Collector, ag AccountGroup) (ThousandAlerts, bool, bool)
+	// getAlertRules returns the alert rules with the tests they are assigned to
+	getAlertRules(t *Collector, ag AccountGroup) (ThousandAlertRules, bool, bool)
+	getTests(t *Collector, ag AccountGroup) ([]ThousandTest, bool, bool)
+	// getAgents returns the agents of the account group by id
+	getAgents(t *Collector, ag AccountGroup) (map[int]ThousandAgent, bool, bool)
+}
+
+// newBackend returns a new backend for every refresh, the v7 backend keeps state (agents) between the requests of one refresh
+func (t *Collector) newBackend() backend {
+	if t.APIVersion == APIVersion7 {
+		return &v7Backend{}
+	}
+	return v6Backend{}
+}
+
+func validateAPIVersion(version string) error {
+	switch version {
+	case "", APIVersion6, APIVersion7:
+		return nil
+	}
+	return fmt.Errorf("unknown ThousandEyes API version %q (%s|%s)", version, APIVersion6, APIVersion7)
+}
+
+// v6Backend is the ThousandEyes API v6, its JSON shapes are the objects of objects.go
+type v6Backend struct{}
+
+func (b v6Backend) getAccountGroups(t *Collector) ([]AccountGroup, bool, bool) {
+	r := Request{
+		URL:            apiURLAccountGroups,
+		ResponseObject: new(ThousandAccountGroups),
+	}
+	bHitAPILimit, bError := CallSingle(t.Token, t.User, t.IsBasicAuth, t.MaxPages, t.retries, &r)
+	return r.ResponseObject.(*ThousandAccountGroups).AccountGroups, bHitAPILimit, bError
+}
+
+func (b v6Backend) getAlerts(t *Collector, ag AccountGroup) (ThousandAlerts, bool, bool) {
+	r := Request{
+		URL:            withAccountGroup(apiURLAlerts, ag),
+		ResponseObject: new(ThousandAlerts),
+	}
+	bHitAPILimit, bError := CallSingle(t.Token, t.User, t.IsBasicAuth, t.MaxPages, t.retries, &r)
+	return *r.ResponseObject.(*ThousandAlerts), bHitAPILimit, bError
+}
+
+// getAlertRules needs the tests for the names of the test ids of the rules
+func (b v6Backend) getAlertRules(t *Collector, ag AccountGroup) (ThousandAlertRules, bool, bool) {
+	var rules ThousandAlertRules
+
+	requests := []Request{
+		{URL: withAccountGroup(apiURLAlertRules, ag), ResponseObject: new(ThousandAlertRules)},
+		{URL: withAccountGroup(apiURLTests, ag), ResponseObject: new(ThousandTests)},
+	}
+	bHitAPILimit, bError := CallSequence(t.Token, t.User, t.IsBasicAuth, t.MaxPages, t.retries, requests)
+	for _, r := range requests {
+		bError = bError || r.Error != nil
+	}
+	if bError {
+		return rules, bHitAPILimit, bError
+	}
+
+	rules = *requests[0].ResponseObject.(*ThousandAlertRules)
+	alertRuleTests(rules.AlertRules, requests[1].ResponseObject.(*ThousandTests).Tests)
+	return rules, bHitAPILimit, bError
+}
+
+func (b v6Backend) getTests(t *Collector, ag AccountGroup) ([]ThousandTest, bool, bool) {
+	r := Request{
+		URL:            withAccountGroup(apiURLTests, ag),
+		ResponseObject: new(ThousandTests),
+	}
+	bHitAPILimit, bError := CallSingle(t.Token, t.User, t.IsBasicAuth, t.MaxPages, t.retries, &r)
+	return r.ResponseObject.(*ThousandTests).Tests, bHitAPILimit, bError
+}
+
+func (b v6Backend) getAgents(t *Collector, ag AccountGroup) (map[int]ThousandAgent, bool, bool) {
+	r := Request{
+		URL:            withAccountGroup(apiURLAgents, ag),
+		ResponseObject: new(ThousandAgents),
+	}
+	bHitAPILimit, bError := CallSingle(t.Token, t.User, t.IsBasicAuth, t.MaxPages, t.retries, &r)
+	return r.ResponseObject.(*ThousandAgents).byID(), bHitAPILimit, bError
+}
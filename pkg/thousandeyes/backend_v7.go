@@ -0,0 +1,467 @@
+package thousandeyes
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+)
+
+const (
+	apiURLv7AccountGroups = "https://api.thousandeyes.com/v7/account-groups"
+	apiURLv7Alerts        = "https://api.thousandeyes.com/v7/alerts"
+	apiURLv7AlertRules    = "https://api.thousandeyes.com/v7/alerts/rules"
+	apiURLv7AlertRule     = "https://api.thousandeyes.com/v7/alerts/rules/%s"
+	apiURLv7Tests         = "https://api.thousandeyes.com/v7/tests"
+	apiURLv7Agents        = "https://api.thousandeyes.com/v7/agents"
+	apiURLv7TestBGP       = "https://api.thousandeyes.com/v7/test-results/%d/bgp"
+	apiURLv7TestHTTP      = "https://api.thousandeyes.com/v7/test-results/%d/http-server"
+	apiURLv7TestNetwork   = "https://api.thousandeyes.com/v7/test-results/%d/network"
+)
+
+// v7Backend is the ThousandEyes API v7
+// v7 results only carry agent ids, so the agents are fetched with the tests to fill in agent name and country
+type v7Backend struct {
+	agents map[string]v7Agent
+}
+
+// alertBreakdownOnce logs a single time that the v7 alerts have no agents and monitors, see collectAlertBreakdown
+var alertBreakdownOnce sync.Once
+
+// v7Links are the HAL links of a v7 response, next is set if there is a following page
+type v7Links struct {
+	Next struct {
+		Href string `json:"href"`
+	} `json:"next"`
+}
+
+type v7AccountGroups struct {
+	AccountGroups []struct {
+		AID                   string `json:"aid"`
+		AccountGroupName      string `json:"accountGroupName"`
+		IsCurrentAccountGroup bool   `json:"isCurrentAccountGroup"`
+		IsDefaultAccountGroup bool   `json:"isDefaultAccountGroup"`
+	} `json:"accountGroups"`
+}
+
+type v7Test struct {
+	TestID   string `json:"testId"`
+	TestName string `json:"testName"`
+	Type     string `json:"type"`
+	Prefix   string `json:"prefix"`
+	Interval int    `json:"interval"`
+	URL      string `json:"url"`
+	Domain   string `json:"domain"`
+	// TargetAgentID is the target of agent-to-agent tests
+	TargetAgentID string `json:"targetAgentId"`
+	Labels        []struct {
+		LabelID string `json:"labelId"`
+		Name    string `json:"name"`
+	} `json:"labels"`
+}
+
+type v7Tests struct {
+	Tests []v7Test `json:"tests"`
+	Links v7Links  `json:"_links"`
+}
+
+type v7Agent struct {
+	AgentID           string   `json:"agentId"`
+	AgentName         string   `json:"agentName"`
+	AgentType         string   `json:"agentType"`
+	CountryID         string   `json:"countryId"`
+	Location          string   `json:"location"`
+	IPAddresses       []string `json:"ipAddresses"`
+	PublicIPAddresses []string `json:"publicIpAddresses"`
+	AgentState        string   `json:"agentState"`
+	LastSeen          string   `json:"lastSeen"`
+	Utilization       int      `json:"utilization"`
+	AgentVersion      string   `json:"agentVersion"`
+}
+
+type v7Agents struct {
+	Agents []v7Agent `json:"agents"`
+	Links  v7Links   `json:"_links"`
+}
+
+type v7Alert struct {
+	ID             string `json:"id"`
+	AlertType      string `json:"alertType"`
+	StartDate      string `json:"startDate"`
+	EndDate        string `json:"endDate"`
+	State          string `json:"state"`
+	ViolationCount int    `json:"violationCount"`
+	AlertRuleID    string `json:"alertRuleId"`
+	TestID         string `json:"testId"`
+}
+
+type v7Alerts struct {
+	Alerts []v7Alert `json:"alerts"`
+	Links  v7Links   `json:"_links"`
+}
+
+type v7AlertRule struct {
+	RuleID     string `json:"ruleId"`
+	RuleName   string `json:"ruleName"`
+	Expression string `json:"expression"`
+	AlertType  string `json:"alertType"`
+	Severity   string `json:"severity"`
+	IsDefault  bool   `json:"isDefault"`
+}
+
+type v7AlertRules struct {
+	AlertRules []v7AlertRule `json:"alertRules"`
+	Links      v7Links       `json:"_links"`
+}
+
+// v7AlertRuleDetails the tests of a rule are only part of its details
+type v7AlertRuleDetails struct {
+	v7AlertRule
+	Tests []struct {
+		TestID   string `json:"testId"`
+		TestName string `json:"testName"`
+	} `json:"tests"`
+}
+
+type v7BGPResults struct {
+	Test    v7Test `json:"test"`
+	Results []struct {
+		Prefix  string `json:"prefix"`
+		Monitor struct {
+			MonitorName string `json:"monitorName"`
+			CountryID   string `json:"countryId"`
+		} `json:"monitor"`
+		Reachability float32 `json:"reachability"`
+		Updates      float32 `json:"updates"`
+		PathChanges  float32 `json:"pathChanges"`
+	} `json:"results"`
+	Links v7Links `json:"_links"`
+}
+
+type v7NetworkResults struct {
+	Test    v7Test `json:"test"`
+	Results []struct {
+		HTTPMetric
+		AgentID string `json:"agentId"`
+	} `json:"results"`
+	Links v7Links `json:"_links"`
+}
+
+type v7HTTPServerResults struct {
+	Test    v7Test `json:"test"`
+	Results []struct {
+		HTTPServerResult
+		AgentID string `json:"agentId"`
+	} `json:"results"`
+	Links v7Links `json:"_links"`
+}
+
+func (r *v7Tests) nextPage() string { return r.Links.Next.Href }
+func (r *v7Tests) appendPage(page interface{}) {
+	r.Tests = append(r.Tests, page.(*v7Tests).Tests...)
+}
+
+func (r *v7Agents) nextPage() string { return r.Links.Next.Href }
+func (r *v7Agents) appendPage(page interface{}) {
+	r.Agents = append(r.Agents, page.(*v7Agents).Agents...)
+}
+
+func (r *v7Alerts) nextPage() string { return r.Links.Next.Href }
+func (r *v7Alerts) appendPage(page interface{}) {
+	r.Alerts = append(r.Alerts, page.(*v7Alerts).Alerts...)
+}
+
+func (r *v7AlertRules) nextPage() string { return r.Links.Next.Href }
+func (r *v7AlertRules) appendPage(page interface{}) {
+	r.AlertRules = append(r.AlertRules, page.(*v7AlertRules).AlertRules...)
+}
+
+func (r *v7BGPResults) nextPage() string { return r.Links.Next.Href }
+func (r *v7BGPResults) appendPage(page interface{}) {
+	r.Results = append(r.Results, page.(*v7BGPResults).Results...)
+}
+
+func (r *v7NetworkResults) nextPage() string { return r.Links.Next.Href }
+func (r *v7NetworkResults) appendPage(page interface{}) {
+	r.Results = append(r.Results, page.(*v7NetworkResults).Results...)
+}
+
+func (r *v7HTTPServerResults) nextPage() string { return r.Links.Next.Href }
+func (r *v7HTTPServerResults) appendPage(page interface{}) {
+	r.Results = append(r.Results, page.(*v7HTTPServerResults).Results...)
+}
+
+// v7ID converts the string ids of v7 to the int ids of v6, they are numeric for all objects we use
+func v7ID(id string) int {
+	i, err := strconv.Atoi(id)
+	if err != nil {
+		log.Printf("ERROR: ThousandEyes API v7 id %q is not numeric.", id)
+	}
+	return i
+}
+
+func (t v7Test) toV6() ThousandTest {
+	test := ThousandTest{
+		TestID:   v7ID(t.TestID),
+		TestName: t.TestName,
+		Type:     t.Type,
+		Prefix:   t.Prefix,
+		Interval: t.Interval,
+		URL:      t.URL,
+		Domain:   t.Domain,
+	}
+	if t.TargetAgentID != "" {
+		test.TargetAgentID = v7ID(t.TargetAgentID)
+	}
+	for _, l := range t.Labels {
+		test.Groups = append(test.Groups, TestGroup{GroupID: v7ID(l.LabelID), Name: l.Name})
+	}
+	return test
+}
+
+// v6AgentTypes and v6AgentStates are the v6 spelling of the v7 agent types and states
+var (
+	v6AgentTypes  = map[string]string{"cloud": "Cloud", "enterprise": "Enterprise", "enterprise-cluster": "Enterprise Cluster"}
+	v6AgentStates = map[string]string{"online": "Online", "offline": "Offline", "disabled": "Disabled"}
+)
+
+func (a v7Agent) toV6() ThousandAgent {
+	agent := ThousandAgent{
+		AgentID:           v7ID(a.AgentID),
+		AgentName:         a.AgentName,
+		AgentType:         a.AgentType,
+		CountryID:         a.CountryID,
+		Location:          a.Location,
+		IPAddresses:       a.IPAddresses,
+		PublicIPAddresses: a.PublicIPAddresses,
+		AgentState:        a.AgentState,
+		LastSeen:          a.LastSeen,
+		Utilization:       a.Utilization,
+		Version:           a.AgentVersion,
+	}
+	if v6, ok := v6AgentTypes[a.AgentType]; ok {
+		agent.AgentType = v6
+	}
+	if v6, ok := v6AgentStates[a.AgentState]; ok {
+		agent.AgentState = v6
+	}
+	return agent
+}
+
+func (b *v7Backend) getAccountGroups(t *Collector) ([]AccountGroup, bool, bool) {
+	r := Request{
+		URL:            apiURLv7AccountGroups,
+		ResponseObject: new(v7AccountGroups),
+	}
+	bHitAPILimit, bError := CallSingle(t.Token, t.User, t.IsBasicAuth, t.MaxPages, t.retries, &r)
+
+	var groups []AccountGroup
+	for _, ag := range r.ResponseObject.(*v7AccountGroups).AccountGroups {
+		g := AccountGroup{AID: v7ID(ag.AID), Name: ag.AccountGroupName}
+		if ag.IsCurrentAccountGroup {
+			g.Current = 1
+		}
+		if ag.IsDefaultAccountGroup {
+			g.Default = 1
+		}
+		groups = append(groups, g)
+	}
+	return groups, bHitAPILimit, bError
+}
+
+// getAlerts needs the alert rules and tests for the rule and test names the v6 alerts carry
+func (b *v7Backend) getAlerts(t *Collector, ag AccountGroup) (ThousandAlerts, bool, bool) {
+	var alerts ThousandAlerts
+
+	requests := []Request{
+		{URL: withAccountGroup(apiURLv7Alerts, ag), ResponseObject: new(v7Alerts)},
+		{URL: withAccountGroup(apiURLv7AlertRules, ag), ResponseObject: new(v7AlertRules)},
+		{URL: withAccountGroup(apiURLv7Tests, ag), ResponseObject: new(v7Tests)},
+	}
+	bHitAPILimit, bError := CallSequence(t.Token, t.User, t.IsBasicAuth, t.MaxPages, t.retries, requests)
+	for _, r := range requests {
+		bError = bError || r.Error != nil
+	}
+	if bError {
+		return alerts, bHitAPILimit, bError
+	}
+	alertBreakdownOnce.Do(func() {
+		log.Println("INFO: The v7 alerts do not list their agents and monitors, thousandeyes_alert_agent* and thousandeyes_alert_monitor* are only exported with ThousandEyes API v6.")
+	})
+
+	rules := map[string]int{}
+	rr := requests[1].ResponseObject.(*v7AlertRules).AlertRules
+	for i := range rr {
+		rules[rr[i].RuleID] = i
+	}
+	tests := map[string]v7Test{}
+	for _, test := range requests[2].ResponseObject.(*v7Tests).Tests {
+		tests[test.TestID] = test
+	}
+
+	for _, a := range requests[0].ResponseObject.(*v7Alerts).Alerts {
+		alert := ThousandAlert{
+			AlertID:        v7ID(a.ID),
+			DateStart:      a.StartDate,
+			DateEnd:        a.EndDate,
+			RuleID:         v7ID(a.AlertRuleID),
+			TestID:         v7ID(a.TestID),
+			TestName:       tests[a.TestID].TestName,
+			ViolationCount: a.ViolationCount,
+			Type:           a.AlertType,
+		}
+		if a.State == "active" {
+			alert.Active = 1
+		}
+		if i, ok := rules[a.AlertRuleID]; ok {
+			alert.RuleName = rr[i].RuleName
+			alert.RuleExpression = rr[i].Expression
+		}
+		alerts.Alert = append(alerts.Alert, alert)
+	}
+	return alerts, bHitAPILimit, bError
+}
+
+// getAlertRules needs the details of every rule for the tests it is assigned to
+func (b *v7Backend) getAlertRules(t *Collector, ag AccountGroup) (ThousandAlertRules, bool, bool) {
+	var rules ThousandAlertRules
+
+	r := Request{
+		URL:            withAccountGroup(apiURLv7AlertRules, ag),
+		ResponseObject: new(v7AlertRules),
+	}
+	bHitAPILimit, bError := CallSingle(t.Token, t.User, t.IsBasicAuth, t.MaxPages, t.retries, &r)
+	if bError {
+		return rules, bHitAPILimit, bError
+	}
+
+	var requests []Request
+	for _, rule := range r.ResponseObject.(*v7AlertRules).AlertRules {
+		requests = append(requests, Request{
+			URL:            withAccountGroup(fmt.Sprintf(apiURLv7AlertRule, rule.RuleID), ag),
+			ResponseObject: new(v7AlertRuleDetails),
+		})
+	}
+	bHitAPILimit, bError = CallParallel(t.Token, t.User, t.IsBasicAuth, t.MaxParallelRequests, t.MaxPages, t.retries, requests)
+	for _, r := range requests {
+		bError = bError || r.Error != nil
+	}
+	if bError {
+		return rules, bHitAPILimit, bError
+	}
+
+	for _, r := range requests {
+		details := r.ResponseObject.(*v7AlertRuleDetails)
+		rule := ThousandAlertRule{
+			RuleID:     v7ID(details.RuleID),
+			RuleName:   details.RuleName,
+			Expression: details.Expression,
+			AlertType:  details.AlertType,
+			Severity:   details.Severity,
+		}
+		if details.IsDefault {
+			rule.Default = 1
+		}
+		for _, test := range details.Tests {
+			rule.TestIDs = append(rule.TestIDs, v7ID(test.TestID))
+			rule.Tests = append(rule.Tests, AlertRuleTest{TestID: v7ID(test.TestID), TestName: test.TestName})
+		}
+		rules.AlertRules = append(rules.AlertRules, rule)
+	}
+	return rules, bHitAPILimit, bError
+}
+
+func (b *v7Backend) getTests(t *Collector, ag AccountGroup) ([]ThousandTest, bool, bool) {
+	var tests []ThousandTest
+
+	requests := []Request{
+		{URL: withAccountGroup(apiURLv7Tests, ag), ResponseObject: new(v7Tests)},
+		{URL: withAccountGroup(apiURLv7Agents, ag), ResponseObject: new(v7Agents)},
+	}
+	bHitAPILimit, bError := CallSequence(t.Token, t.User, t.IsBasicAuth, t.MaxPages, t.retries, requests)
+	for _, r := range requests {
+		bError = bError || r.Error != nil
+	}
+	if bError {
+		return tests, bHitAPILimit, bError
+	}
+
+	b.setAgents(requests[1].ResponseObject.(*v7Agents))
+	for _, test := range requests[0].ResponseObject.(*v7Tests).Tests {
+		tests = append(tests, test.toV6())
+	}
+	return tests, bHitAPILimit, bError
+}
+
+func (b *v7Backend) setAgents(agents *v7Agents) {
+	b.agents = map[string]v7Agent{}
+	for _, a := range agents.Agents {
+		b.agents[a.AgentID] = a
+	}
+}
+
+// getAgents uses the agents fetched with the tests, it only requests them if the tests were not fetched
+func (b *v7Backend) getAgents(t *Collector, ag AccountGroup) (map[int]ThousandAgent, bool, bool) {
+	var bHitAPILimit, bError bool
+	if b.agents == nil {
+		r := Request{
+			URL:            withAccountGroup(apiURLv7Agents, ag),
+			ResponseObject: new(v7Agents),
+		}
+		bHitAPILimit, bError = CallSingle(t.Token, t.User, t.IsBasicAuth, t.MaxPages, t.retries, &r)
+		if bError {
+			return nil, bHitAPILimit, bError
+		}
+		b.setAgents(r.ResponseObject.(*v7Agents))
+	}
+
+	agents := map[int]ThousandAgent{}
+	for _, a := range b.agents {
+		agent := a.toV6()
+		agents[agent.AgentID] = agent
+	}
+	return agents, bHitAPILimit, bError
+}
+
+func (r *v7BGPResults) result(ctx *TestContext) interface{} {
+	res := new(BGPTestResults)
+	res.Net.Test = r.Test.toV6()
+	for _, m := range r.Results {
+		res.Net.BgpMetrics = append(res.Net.BgpMetrics, BGPMetric{
+			CountryID:    m.Monitor.CountryID,
+			Prefix:       m.Prefix,
+			MonitorName:  m.Monitor.MonitorName,
+			Reachability: m.Reachability,
+			Updates:      m.Updates,
+			PathChanges:  m.PathChanges,
+		})
+	}
+	return res
+}
+
+func (r *v7NetworkResults) result(ctx *TestContext) interface{} {
+	res := new(HTTPTestMetricResults)
+	res.Net.Test = r.Test.toV6()
+	for _, m := range r.Results {
+		metric := m.HTTPMetric
+		agent := ctx.v7Agent(m.AgentID)
+		metric.AgentName = agent.AgentName
+		metric.CountryID = agent.CountryID
+		res.Net.HTTPMetrics = append(res.Net.HTTPMetrics, metric)
+	}
+	return res
+}
+
+func (r *v7HTTPServerResults) result(ctx *TestContext) interface{} {
+	res := new(HTTPTestWebServerResults)
+	res.Web.Test = r.Test.toV6()
+	for _, m := range r.Results {
+		server := m.HTTPServerResult
+		agent := ctx.v7Agent(m.AgentID)
+		server.AgentID = v7ID(m.AgentID)
+		server.AgentName = agent.AgentName
+		server.CountryID = agent.CountryID
+		res.Web.HTTPServer = append(res.Web.HTTPServer, server)
+	}
+	return res
+}
@@ -0,0 +1,176 @@
+package thousandeyes
+
+import (
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"log"
+	"strconv"
+	"strings"
+)
+
+const apiURLTestBGPRoutes = "https://api.thousandeyes.com/v6/net/bgp-routes/%d.json"
+
+var (
+	// - bgp routes
+	ThousandTestBGPOriginASDesc = prometheus.NewDesc(
+		"thousandeyes_test_bgp_origin_as",
+		"BGP test ran in ThousandEyes - origin AS (last AS of the AS path) of the prefix seen by the monitor.",
+		[]string{"test_id", "test_name", "type", "prefix", "country", "monitor_name", "account_group_id", "account_group_name"},
+		nil)
+	ThousandTestBGPASPathsDesc = prometheus.NewDesc(
+		"thousandeyes_test_bgp_as_paths",
+		"BGP test ran in ThousandEyes - number of distinct AS paths to the prefix seen by all monitors.",
+		[]string{"test_id", "test_name", "type", "prefix", "account_group_id", "account_group_name"},
+		nil)
+	ThousandTestBGPOriginASMismatchDesc = prometheus.NewDesc(
+		"thousandeyes_test_bgp_origin_as_mismatch",
+		"BGP test ran in ThousandEyes - 1 if the origin AS seen by the monitor is not the expected origin AS of the prefix (bgp.expected_origin_as), 0 otherwise.",
+		[]string{"test_id", "test_name", "type", "prefix", "country", "monitor_name", "expected_origin_as", "account_group_id", "account_group_name"},
+		nil)
+)
+
+//https://api.thousandeyes.com/v6/net/bgp-routes/557962.json
+
+// BGPRouteTestResults BGP route details of a test
+type BGPRouteTestResults struct {
+	Net struct {
+		Test   ThousandTest `json:"test"`
+		Routes []BGPRoute   `json:"routes"`
+	} `json:"net"`
+	Pages Pages `json:"pages"`
+	// AccountGroup the test belongs to
+	AccountGroup AccountGroup `json:"-"`
+	// ExpectedOriginAS per prefix, the mismatch is exported for the prefixes in it only
+	ExpectedOriginAS map[string]int `json:"-"`
+}
+
+// BGPRoute route of a prefix seen by a monitor
+type BGPRoute struct {
+	Prefix      string `json:"prefix"`
+	MonitorID   int    `json:"monitorId"`
+	MonitorName string `json:"monitorName"`
+	CountryID   string `json:"countryId"`
+	ASPath      []int  `json:"asPath"`
+}
+
+func (r *BGPRouteTestResults) nextPage() string { return r.Pages.Next }
+func (r *BGPRouteTestResults) appendPage(page interface{}) {
+	r.Net.Routes = append(r.Net.Routes, page.(*BGPRouteTestResults).Net.Routes...)
+}
+
+// originAS is the last AS of the AS path, 0 if the path is empty (prefix not reachable)
+func (r BGPRoute) originAS() int {
+	if len(r.ASPath) == 0 {
+		return 0
+	}
+	return r.ASPath[len(r.ASPath)-1]
+}
+
+func (r BGPRoute) asPath() string {
+	var path []string
+	for _, as := range r.ASPath {
+		path = append(path, strconv.Itoa(as))
+	}
+	return strings.Join(path, " ")
+}
+
+// newBGPRoutesHandler collects the routes of bgp tests, the mismatch for the prefixes in expectedOriginAS
+// the results are v6 only, the API v7 has no BGP route details
+func newBGPRoutesHandler(expectedOriginAS map[string]int) TestHandler {
+	return resultHandler{
+		handlerInfo: handlerInfo{
+			family:    FamilyBGPRoutes,
+			testTypes: []string{"bgp"},
+			descs: []*prometheus.Desc{
+				ThousandTestBGPOriginASDesc,
+				ThousandTestBGPASPathsDesc,
+				ThousandTestBGPOriginASMismatchDesc,
+			},
+		},
+		requests: resultRequests{
+			APIVersion6: {apiURLTestBGPRoutes, func() interface{} { return new(BGPRouteTestResults) }},
+		},
+		complete: func(ctx *TestContext, result interface{}) {
+			result.(*BGPRouteTestResults).ExpectedOriginAS = expectedOriginAS
+		},
+		collect: collectBGPRoutes,
+	}
+}
+
+func collectBGPRoutes(tRoutes []BGPRouteTestResults, ch chan<- prometheus.Metric) {
+
+	for e := range tRoutes {
+		if len(tRoutes[e].Net.Routes) == 0 {
+			log.Println("INFO: BGP route metrics are empty for Test:", tRoutes[e])
+			continue
+		}
+		test := tRoutes[e].Net.Test
+		ag := tRoutes[e].AccountGroup
+
+		var prefixes []string
+		paths := map[string]map[string]bool{}
+
+		for _, r := range tRoutes[e].Net.Routes {
+
+			if _, ok := paths[r.Prefix]; !ok {
+				prefixes = append(prefixes, r.Prefix)
+				paths[r.Prefix] = map[string]bool{}
+			}
+			if len(r.ASPath) == 0 {
+				continue
+			}
+			paths[r.Prefix][r.asPath()] = true
+
+			ch <- prometheus.MustNewConstMetric(
+				ThousandTestBGPOriginASDesc,
+				prometheus.GaugeValue,
+				float64(r.originAS()),
+				fmt.Sprintf("%d", test.TestID),
+				test.TestName,
+				test.Type,
+				r.Prefix,
+				r.CountryID,
+				r.MonitorName,
+				fmt.Sprintf("%d", ag.AID),
+				ag.Name,
+			)
+
+			expected, ok := tRoutes[e].ExpectedOriginAS[r.Prefix]
+			if !ok {
+				continue
+			}
+			mismatch := 0.0
+			if r.originAS() != expected {
+				mismatch = 1
+			}
+			ch <- prometheus.MustNewConstMetric(
+				ThousandTestBGPOriginASMismatchDesc,
+				prometheus.GaugeValue,
+				mismatch,
+				fmt.Sprintf("%d", test.TestID),
+				test.TestName,
+				test.Type,
+				r.Prefix,
+				r.CountryID,
+				r.MonitorName,
+				strconv.Itoa(expected),
+				fmt.Sprintf("%d", ag.AID),
+				ag.Name,
+			)
+		}
+
+		for _, prefix := range prefixes {
+			ch <- prometheus.MustNewConstMetric(
+				ThousandTestBGPASPathsDesc,
+				prometheus.GaugeValue,
+				float64(len(paths[prefix])),
+				fmt.Sprintf("%d", test.TestID),
+				test.TestName,
+				test.Type,
+				prefix,
+				fmt.Sprintf("%d", ag.AID),
+				ag.Name,
+			)
+		}
+	}
+}
@@ -0,0 +1,316 @@
+package thousandeyes
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// result families of tests, used by the config and the probe modules
+const (
+	FamilyBGP          = "bgp"
+	FamilyHTTP         = "http"
+	FamilyHTTPMetrics  = "http-metrics"
+	FamilyPageLoad     = "page-load"
+	FamilyTransaction  = "transactions"
+	FamilyDNS          = "dns"
+	FamilyDNSSEC       = "dnssec"
+	FamilyNetwork      = "network"
+	FamilyAgentToAgent = "agent-to-agent"
+	FamilyPathVis      = "path-vis"
+	FamilyBGPRoutes    = "bgp-routes"
+	FamilyVoice        = "voice"
+	FamilySIPServer    = "sip-server"
+	FamilyFTPServer    = "ftp-server"
+)
+
+var labelNameRegex = regexp.MustCompile("^[a-zA-Z_][a-zA-Z0-9_]*$")
+
+// Config is the content of the YAML config file, it can be reloaded at runtime
+type Config struct {
+	Credentials   CredentialsConfig   `yaml:"credentials"`
+	APIVersion    string              `yaml:"api_version"`
+	AccountGroups AccountGroupsConfig `yaml:"account_groups"`
+	Tests         TestsConfig         `yaml:"tests"`
+	// Families are the result families collected by the poller for /metrics
+	Families []string      `yaml:"families"`
+	Polling  PollingConfig `yaml:"polling"`
+	BGP      BGPConfig     `yaml:"bgp"`
+	Agents   AgentsConfig  `yaml:"agents"`
+	// EndpointAgents is opt-in, the results of many laptops are aggregated
+	EndpointAgents EndpointAgentsConfig `yaml:"endpoint_agents"`
+	AlertRules     AlertRulesConfig     `yaml:"alert_rules"`
+	// Timezone is the IANA name of the timezone of the ThousandEyes account, the v6 API gives dates without zone
+	Timezone string `yaml:"timezone"`
+	// MaxParallelRequests limits the test detail requests running at the same time
+	MaxParallelRequests int `yaml:"max_parallel_requests"`
+	// MaxTransactionSteps limits the distinct step names exported per transaction test
+	MaxTransactionSteps int `yaml:"max_transaction_steps"`
+	// MaxPages caps the pages fetched for one paginated request, DefaultMaxPages if not set
+	MaxPages int `yaml:"max_pages"`
+	// Labels are added to every series of /metrics, e.g. the region the exporter runs in
+	Labels map[string]string `yaml:"labels"`
+	// Modules are the named modules of /probe
+	Modules map[string]ProbeModule `yaml:"modules"`
+
+	// Hash of the file content, exported as thousandeyes_config_hash
+	Hash float64 `yaml:"-"`
+}
+
+// CredentialsConfig is either a bearer token or basic auth user and token
+type CredentialsConfig struct {
+	BearerToken    string `yaml:"bearer_token"`
+	BasicAuthUser  string `yaml:"basic_auth_user"`
+	BasicAuthToken string `yaml:"basic_auth_token"`
+}
+
+// AccountGroupsConfig see AccountGroupSelection
+type AccountGroupsConfig struct {
+	Names []string `yaml:"names"`
+	Regex string   `yaml:"regex"`
+}
+
+// TestsConfig restricts the tests whose details are fetched, see TestFilter
+type TestsConfig struct {
+	Include TestMatcherConfig `yaml:"include"`
+	Exclude TestMatcherConfig `yaml:"exclude"`
+}
+
+// TestMatcherConfig see TestMatcher
+type TestMatcherConfig struct {
+	TestIDs   []int    `yaml:"test_ids"`
+	NameRegex string   `yaml:"name_regex"`
+	Types     []string `yaml:"types"`
+	Labels    []string `yaml:"labels"`
+}
+
+// BGPConfig ExpectedOriginAS maps prefixes to the AS expected to originate them, see thousandeyes_test_bgp_origin_as_mismatch
+type BGPConfig struct {
+	ExpectedOriginAS map[string]int `yaml:"expected_origin_as"`
+}
+
+// AgentsConfig Enabled adds the agent inventory of the account groups (thousandeyes_agent_*)
+type AgentsConfig struct {
+	Enabled bool `yaml:"enabled"`
+}
+
+// EndpointAgentsConfig Enabled adds the endpoint agents and their scheduled tests (thousandeyes_endpoint_*),
+// AggregateBy are the labels (location|network|agent) the series are aggregated by, location if not set
+type EndpointAgentsConfig struct {
+	Enabled     bool     `yaml:"enabled"`
+	AggregateBy []string `yaml:"aggregate_by"`
+}
+
+// AlertRulesConfig Enabled adds the alert rules and the tests they are assigned to (thousandeyes_alert_rule_*)
+type AlertRulesConfig struct {
+	Enabled bool `yaml:"enabled"`
+}
+
+// PollingConfig are the intervals of the background poller
+type PollingConfig struct {
+	Interval              time.Duration `yaml:"interval"`
+	TestsInterval         time.Duration `yaml:"tests_interval"`
+	AccountGroupsInterval time.Duration `yaml:"account_groups_interval"`
+}
+
+// LoadConfig reads a YAML config file, it still has to be validated after the credentials are complete
+func LoadConfig(file string) (*Config, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("config %s could not be read: %s", file, err)
+	}
+
+	c := &Config{}
+	if err := yaml.UnmarshalStrict(b, c); err != nil {
+		return nil, fmt.Errorf("config %s could not be parsed: %s", file, err)
+	}
+	c.Hash = md5HashAsMetricValue(b)
+	return c, nil
+}
+
+// IsBasicAuth is true, if no bearer token but basic auth is configured
+func (c *CredentialsConfig) IsBasicAuth() bool {
+	return c.BearerToken == ""
+}
+
+// Validate checks the config as a whole before it is used
+// handlers are the handlers registered with NewCollector, their families may be named in families and the probe modules
+func (c *Config) Validate(handlers ...TestHandler) error {
+	if c.Credentials.BearerToken == "" &&
+		(c.Credentials.BasicAuthUser == "" || c.Credentials.BasicAuthToken == "") {
+		return fmt.Errorf("config: a bearer token or the combination of basic auth user and token must be set")
+	}
+	if err := validateAPIVersion(c.APIVersion); err != nil {
+		return fmt.Errorf("config: %s", err)
+	}
+	if _, err := c.timezone(); err != nil {
+		return fmt.Errorf("config: timezone: %s", err)
+	}
+	if _, err := c.accountGroupSelection(); err != nil {
+		return fmt.Errorf("config: %s", err)
+	}
+	if _, err := c.testFilter(); err != nil {
+		return fmt.Errorf("config: tests: %s", err)
+	}
+	if err := validateFamilies(c.Families, handlers); err != nil {
+		return fmt.Errorf("config: families: %s", err)
+	}
+	for prefix, as := range c.BGP.ExpectedOriginAS {
+		if _, _, err := net.ParseCIDR(prefix); err != nil {
+			return fmt.Errorf("config: bgp: %q is not a prefix", prefix)
+		}
+		if as <= 0 {
+			return fmt.Errorf("config: bgp: expected origin AS of %s must be positive", prefix)
+		}
+	}
+	if err := validateEndpointAggregateBy(c.EndpointAgents.AggregateBy); err != nil {
+		return fmt.Errorf("config: endpoint_agents: %s", err)
+	}
+	if c.EndpointAgents.Enabled && c.APIVersion == APIVersion7 {
+		return fmt.Errorf("config: endpoint_agents: only available with ThousandEyes API %s", APIVersion6)
+	}
+	if c.Polling.Interval < 0 || c.Polling.TestsInterval < 0 || c.Polling.AccountGroupsInterval < 0 {
+		return fmt.Errorf("config: polling intervals must not be negative")
+	}
+	if c.MaxParallelRequests < 0 {
+		return fmt.Errorf("config: max_parallel_requests must not be negative")
+	}
+	if c.MaxTransactionSteps < 0 {
+		return fmt.Errorf("config: max_transaction_steps must not be negative")
+	}
+	if c.MaxPages < 0 {
+		return fmt.Errorf("config: max_pages must not be negative")
+	}
+	for name := range c.Labels {
+		if !labelNameRegex.MatchString(name) || strings.HasPrefix(name, "__") {
+			return fmt.Errorf("config: %q is not a valid label name", name)
+		}
+	}
+	for name, m := range c.Modules {
+		if err := m.validate(handlers); err != nil {
+			return fmt.Errorf("config: module %s: %s", name, err)
+		}
+	}
+	return nil
+}
+
+// timezone UTC if not set
+func (c *Config) timezone() (*time.Location, error) {
+	if c.Timezone == "" {
+		return time.UTC, nil
+	}
+	return time.LoadLocation(c.Timezone)
+}
+
+func (c *Config) accountGroupSelection() (AccountGroupSelection, error) {
+	return ParseAccountGroupSelection(strings.Join(c.AccountGroups.Names, ","), c.AccountGroups.Regex)
+}
+
+func (c *Config) testFilter() (TestFilter, error) {
+	var f TestFilter
+	var err error
+
+	i := c.Tests.Include
+	f.Include, err = NewTestMatcher(i.TestIDs, i.NameRegex, i.Types, i.Labels)
+	if err != nil {
+		return f, fmt.Errorf("include: %s", err)
+	}
+	e := c.Tests.Exclude
+	f.Exclude, err = NewTestMatcher(e.TestIDs, e.NameRegex, e.Types, e.Labels)
+	if err != nil {
+		return f, fmt.Errorf("exclude: %s", err)
+	}
+	return f, nil
+}
+
+// probeModules are the configured modules, DefaultProbeModule fetches the families of /metrics if it is not configured
+func (c *Config) probeModules() map[string]ProbeModule {
+	modules := map[string]ProbeModule{}
+	for name, m := range c.Modules {
+		modules[name] = m
+	}
+	if _, ok := modules[DefaultProbeModule]; !ok && len(c.Families) > 0 {
+		modules[DefaultProbeModule] = ProbeModule{Families: c.Families}
+	}
+	return modules
+}
+
+// NewCollector builds the collector for a validated config
+// the handlers are collected in addition to the families of the config, a handler replaces the built-in handler of its family
+func (c *Config) NewCollector(handlers ...TestHandler) (*Collector, error) {
+	agSelection, err := c.accountGroupSelection()
+	if err != nil {
+		return nil, err
+	}
+	testFilter, err := c.testFilter()
+	if err != nil {
+		return nil, err
+	}
+	timezone, err := c.timezone()
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Collector{
+		IsBasicAuth:               c.Credentials.IsBasicAuth(),
+		Token:                     c.token(),
+		User:                      c.Credentials.BasicAuthUser,
+		ExpectedOriginAS:          c.BGP.ExpectedOriginAS,
+		IsCollectAgents:           c.Agents.Enabled,
+		IsCollectEndpointAgents:   c.EndpointAgents.Enabled,
+		EndpointAggregateBy:       c.EndpointAgents.AggregateBy,
+		IsCollectAlertRules:       c.AlertRules.Enabled,
+		Timezone:                  timezone,
+		AccountGroups:             agSelection,
+		TestFilter:                testFilter,
+		ProbeModules:              c.probeModules(),
+		PollInterval:              c.Polling.Interval,
+		TestsPollInterval:         c.Polling.TestsInterval,
+		AccountGroupsPollInterval: c.Polling.AccountGroupsInterval,
+		MaxParallelRequests:       c.MaxParallelRequests,
+		MaxPages:                  c.MaxPages,
+		MaxTransactionSteps:       c.MaxTransactionSteps,
+		APIVersion:                c.APIVersion,
+	}
+	t.TestHandlers = familyHandlers(t, c.Families, handlers)
+	return t, nil
+}
+
+func (c *Config) token() string {
+	if c.Credentials.IsBasicAuth() {
+		return c.Credentials.BasicAuthToken
+	}
+	return c.Credentials.BearerToken
+}
+
+func validateFamilies(families []string, handlers []TestHandler) error {
+	for _, f := range families {
+		if !isFamily(f, handlers) {
+			return fmt.Errorf("unknown result family %q", f)
+		}
+	}
+	return nil
+}
+
+func hasFamily(families []string, family string) bool {
+	for _, f := range families {
+		if f == family {
+			return true
+		}
+	}
+	return false
+}
+
+// md5HashAsMetricValue uses 48 bits of the md5 sum, a float64 has a 53 bit mantissa only
+func md5HashAsMetricValue(data []byte) float64 {
+	sum := md5.Sum(data)
+	b := make([]byte, 8)
+	copy(b, sum[0:6])
+	return float64(binary.LittleEndian.Uint64(b))
+}
@@ -0,0 +1,133 @@
+package thousandeyes
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfigValidate(t *testing.T) {
+	token := CredentialsConfig{BearerToken: "token"}
+
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr string
+	}{
+		{"token only, as configured by the flags without -Get*", Config{Credentials: token, Families: []string{}}, ""},
+		{"basic auth", Config{Credentials: CredentialsConfig{BasicAuthUser: "user", BasicAuthToken: "token"}}, ""},
+		{"all set", Config{
+			Credentials:         token,
+			APIVersion:          APIVersion7,
+			Timezone:            "Europe/Berlin",
+			Families:            []string{FamilyBGP, FamilyHTTP},
+			BGP:                 BGPConfig{ExpectedOriginAS: map[string]int{"10.0.0.0/8": 64512}},
+			Polling:             PollingConfig{Interval: time.Minute, TestsInterval: 5 * time.Minute, AccountGroupsInterval: time.Hour},
+			MaxParallelRequests: 10,
+			MaxPages:            10,
+			Labels:              map[string]string{"region": "eu-de-1"},
+			Modules:             map[string]ProbeModule{"web": {Families: []string{FamilyHTTP}}},
+		}, ""},
+		{"no credentials", Config{}, "a bearer token"},
+		{"basic auth without token", Config{Credentials: CredentialsConfig{BasicAuthUser: "user"}}, "a bearer token"},
+		{"unknown api version", Config{Credentials: token, APIVersion: "v5"}, "unknown ThousandEyes API version"},
+		{"unknown timezone", Config{Credentials: token, Timezone: "Mars/Olympus"}, "timezone"},
+		{"unknown family", Config{Credentials: token, Families: []string{"smtp"}}, "families"},
+		{"bgp prefix", Config{Credentials: token, BGP: BGPConfig{ExpectedOriginAS: map[string]int{"10.0.0.0": 64512}}}, "is not a prefix"},
+		{"bgp origin as", Config{Credentials: token, BGP: BGPConfig{ExpectedOriginAS: map[string]int{"10.0.0.0/8": 0}}}, "must be positive"},
+		{"endpoint aggregation", Config{Credentials: token, EndpointAgents: EndpointAgentsConfig{AggregateBy: []string{"city"}}}, "unknown aggregation"},
+		{"endpoint agents on v7", Config{Credentials: token, APIVersion: APIVersion7, EndpointAgents: EndpointAgentsConfig{Enabled: true}}, "only available"},
+		{"negative interval", Config{Credentials: token, Polling: PollingConfig{AccountGroupsInterval: -time.Second}}, "intervals must not be negative"},
+		{"negative max_parallel_requests", Config{Credentials: token, MaxParallelRequests: -1}, "max_parallel_requests"},
+		{"negative max_transaction_steps", Config{Credentials: token, MaxTransactionSteps: -1}, "max_transaction_steps"},
+		{"negative max_pages", Config{Credentials: token, MaxPages: -1}, "max_pages"},
+		{"label name", Config{Credentials: token, Labels: map[string]string{"__region": "eu"}}, "not a valid label name"},
+		{"module without families", Config{Credentials: token, Modules: map[string]ProbeModule{"web": {}}}, "module web: no result families"},
+		{"module family", Config{Credentials: token, Modules: map[string]ProbeModule{"web": {Families: []string{"smtp"}}}}, "module web: unknown result family"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				if _, err := tt.config.NewCollector(); err != nil {
+					t.Fatalf("collector of a valid config: %s", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConfigValidateRegisteredFamilies(t *testing.T) {
+	token := CredentialsConfig{BearerToken: "token"}
+	smtp := []string{"smtp"}
+
+	tests := []struct {
+		name     string
+		config   Config
+		handlers []TestHandler
+		wantErr  string
+	}{
+		{"family of a registered handler", Config{Credentials: token, Families: smtp}, []TestHandler{smtpHandler{}}, ""},
+		{"module family of a registered handler", Config{Credentials: token, Modules: map[string]ProbeModule{"mail": {Families: smtp}}}, []TestHandler{smtpHandler{}}, ""},
+		{"built-in and registered families", Config{Credentials: token, Families: []string{FamilyHTTP, "smtp"}}, []TestHandler{smtpHandler{}}, ""},
+		{"handler not registered", Config{Credentials: token, Families: smtp}, nil, "families: unknown result family"},
+		{"module family, handler not registered", Config{Credentials: token, Modules: map[string]ProbeModule{"mail": {Families: smtp}}}, nil, "module mail: unknown result family"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate(tt.handlers...)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %s", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConfigProbeModules(t *testing.T) {
+	web := ProbeModule{Families: []string{FamilyHTTP}}
+
+	tests := []struct {
+		name        string
+		families    []string
+		modules     map[string]ProbeModule
+		wantDefault []string
+	}{
+		{"no families, no default module", nil, nil, nil},
+		{"default module of the families", []string{FamilyBGP}, map[string]ProbeModule{"web": web}, []string{FamilyBGP}},
+		{"configured default module", []string{FamilyBGP}, map[string]ProbeModule{DefaultProbeModule: web}, []string{FamilyHTTP}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Config{Families: tt.families, Modules: tt.modules}
+			modules := c.probeModules()
+			m, ok := modules[DefaultProbeModule]
+			if ok != (tt.wantDefault != nil) || strings.Join(m.Families, ",") != strings.Join(tt.wantDefault, ",") {
+				t.Errorf("default module %v (%t), want %v", m.Families, ok, tt.wantDefault)
+			}
+			for name := range tt.modules {
+				if _, ok := modules[name]; !ok {
+					t.Errorf("module %s is missing", name)
+				}
+			}
+			if _, ok := c.Modules[DefaultProbeModule]; ok != (tt.modules[DefaultProbeModule].Families != nil) {
+				t.Errorf("the modules of the config were modified")
+			}
+		})
+	}
+}
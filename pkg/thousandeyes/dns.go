@@ -0,0 +1,241 @@
+package thousandeyes
+
+import (
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"log"
+)
+
+const (
+	apiURLTestDNSServer   = "https://api.thousandeyes.com/v6/dns/server/%d.json"
+	apiURLTestDNSTrace    = "https://api.thousandeyes.com/v6/dns/trace/%d.json"
+	apiURLv7TestDNSServer = "https://api.thousandeyes.com/v7/test-results/%d/dns-server"
+	apiURLv7TestDNSTrace  = "https://api.thousandeyes.com/v7/test-results/%d/dns-trace"
+)
+
+// dnsTestLabels are the labels of DNS test metrics, dns_server is the server queried (last server queried for traces)
+var dnsTestLabels = []string{"test_id", "test_name", "type", "domain", "dns_server", "country", "agent_name", "account_group_id", "account_group_name"}
+
+var (
+	// - dns tests
+	ThousandTestDNSResolutionTimeDesc = prometheus.NewDesc(
+		"thousandeyes_test_dns_resolution_time_milliseconds",
+		"DNS server or trace test ran in ThousandEyes - metric: resolutionTime.",
+		dnsTestLabels,
+		nil)
+	ThousandTestDNSAvailableDesc = prometheus.NewDesc(
+		"thousandeyes_test_dns_available",
+		"DNS server or trace test ran in ThousandEyes - 1 if the domain was resolved without error, 0 otherwise.",
+		dnsTestLabels,
+		nil)
+	ThousandTestDNSErrorInfoDesc = prometheus.NewDesc(
+		"thousandeyes_test_dns_error_info",
+		"DNS server or trace test ran in ThousandEyes - always 1, only present if the agent saw an error, its type (e.g. NXDOMAIN, timeout) is the label error_type.",
+		append(append([]string{}, dnsTestLabels...), "error_type"),
+		nil)
+)
+
+//https://api.thousandeyes.com/v6/dns/server/612434.json
+
+// DNSServerTestResults DNS server test details
+type DNSServerTestResults struct {
+	DNS struct {
+		Test   ThousandTest `json:"test"`
+		Server []DNSResult  `json:"server"`
+	} `json:"dns"`
+	Pages Pages `json:"pages"`
+	// AccountGroup the test belongs to
+	AccountGroup AccountGroup `json:"-"`
+}
+
+//https://api.thousandeyes.com/v6/dns/trace/612434.json
+
+// DNSTraceTestResults DNS trace test details
+type DNSTraceTestResults struct {
+	DNS struct {
+		Test  ThousandTest `json:"test"`
+		Trace []DNSResult  `json:"trace"`
+	} `json:"dns"`
+	Pages Pages `json:"pages"`
+	// AccountGroup the test belongs to
+	AccountGroup AccountGroup `json:"-"`
+}
+
+// DNSTestResults are the results of a dns-server or dns-trace test, the responses of both differ by shape only
+type DNSTestResults struct {
+	Test    ThousandTest
+	Results []DNSResult
+	// AccountGroup the test belongs to
+	AccountGroup AccountGroup
+}
+
+// DNSResult resolution of the test domain seen by an agent, Server is set for server tests, FinalServerQueried for traces
+type DNSResult struct {
+	Server             string `json:"server"`
+	FinalServerQueried string `json:"finalServerQueried"`
+	ResolutionTime     int    `json:"resolutionTime"`
+	ErrorType          string `json:"errorType"`
+	ErrorDetails       string `json:"errorDetails"`
+	AgentName          string `json:"agentName"`
+	CountryID          string `json:"countryId"`
+	Date               string `json:"date"`
+	AgentID            int    `json:"agentId"`
+	RoundID            int    `json:"roundId"`
+}
+
+func (r *DNSServerTestResults) nextPage() string { return r.Pages.Next }
+func (r *DNSServerTestResults) appendPage(page interface{}) {
+	r.DNS.Server = append(r.DNS.Server, page.(*DNSServerTestResults).DNS.Server...)
+}
+
+func (r *DNSTraceTestResults) nextPage() string { return r.Pages.Next }
+func (r *DNSTraceTestResults) appendPage(page interface{}) {
+	r.DNS.Trace = append(r.DNS.Trace, page.(*DNSTraceTestResults).DNS.Trace...)
+}
+
+func (r *DNSServerTestResults) result(ctx *TestContext) interface{} {
+	return &DNSTestResults{Test: r.DNS.Test, Results: r.DNS.Server}
+}
+
+func (r *DNSTraceTestResults) result(ctx *TestContext) interface{} {
+	return &DNSTestResults{Test: r.DNS.Test, Results: r.DNS.Trace}
+}
+
+// dnsServer is the DNS server the result was answered by
+func (r DNSResult) dnsServer() string {
+	if r.Server != "" {
+		return r.Server
+	}
+	return r.FinalServerQueried
+}
+
+// errorType is the error type of the result, "" if there was no error
+// some errors come with details only, their details are not used as label value to keep the cardinality bounded
+func (r DNSResult) errorType() string {
+	if isErrorType(r.ErrorType) {
+		return r.ErrorType
+	}
+	if r.ErrorDetails != "" {
+		return "other"
+	}
+	return ""
+}
+
+type v7DNSResults struct {
+	Test    v7Test `json:"test"`
+	Results []struct {
+		DNSResult
+		AgentID string `json:"agentId"`
+	} `json:"results"`
+	Links v7Links `json:"_links"`
+}
+
+func (r *v7DNSResults) nextPage() string { return r.Links.Next.Href }
+func (r *v7DNSResults) appendPage(page interface{}) {
+	r.Results = append(r.Results, page.(*v7DNSResults).Results...)
+}
+
+// v7DNSServerResults and v7DNSTraceResults have the same shape, the type tells which test type they belong to
+type v7DNSServerResults struct{ v7DNSResults }
+type v7DNSTraceResults struct{ v7DNSResults }
+
+func (r *v7DNSServerResults) appendPage(page interface{}) {
+	r.v7DNSResults.appendPage(&page.(*v7DNSServerResults).v7DNSResults)
+}
+
+func (r *v7DNSTraceResults) appendPage(page interface{}) {
+	r.v7DNSResults.appendPage(&page.(*v7DNSTraceResults).v7DNSResults)
+}
+
+func (r *v7DNSResults) result(ctx *TestContext) interface{} {
+	var results []DNSResult
+	for _, m := range r.Results {
+		result := m.DNSResult
+		result.AgentID = v7ID(m.AgentID)
+		agent := ctx.v7Agent(m.AgentID)
+		result.AgentName = agent.AgentName
+		result.CountryID = agent.CountryID
+		results = append(results, result)
+	}
+	return &DNSTestResults{Test: r.Test.toV6(), Results: results}
+}
+
+// newDNSHandler collects the results of dns-server and dns-trace tests
+func newDNSHandler() TestHandler {
+	return resultHandler{
+		handlerInfo: handlerInfo{
+			family:    FamilyDNS,
+			testTypes: []string{"dns-server", "dns-trace"},
+			descs: []*prometheus.Desc{
+				ThousandTestDNSResolutionTimeDesc,
+				ThousandTestDNSAvailableDesc,
+				ThousandTestDNSErrorInfoDesc,
+			},
+		},
+		requests: resultRequests{
+			APIVersion6: {apiURLTestDNSServer, func() interface{} { return new(DNSServerTestResults) }},
+			APIVersion7: {apiURLv7TestDNSServer, func() interface{} { return new(v7DNSServerResults) }},
+		},
+		typeRequests: map[string]resultRequests{
+			"dns-trace": {
+				APIVersion6: {apiURLTestDNSTrace, func() interface{} { return new(DNSTraceTestResults) }},
+				APIVersion7: {apiURLv7TestDNSTrace, func() interface{} { return new(v7DNSTraceResults) }},
+			},
+		},
+		collect: collectDNS,
+	}
+}
+
+func collectDNS(tDNS []DNSTestResults, ch chan<- prometheus.Metric) {
+
+	for e := range tDNS {
+		if len(tDNS[e].Results) == 0 {
+			log.Println("INFO: DNS metrics are empty for Test:", tDNS[e])
+			continue
+		}
+		collectDNSResults(tDNS[e].Test, tDNS[e].Results, tDNS[e].AccountGroup, ch)
+	}
+}
+
+func collectDNSResults(test ThousandTest, results []DNSResult, ag AccountGroup, ch chan<- prometheus.Metric) {
+
+	for _, r := range results {
+
+		labels := []string{
+			fmt.Sprintf("%d", test.TestID),
+			test.TestName,
+			test.Type,
+			test.Domain,
+			r.dnsServer(),
+			r.CountryID,
+			r.AgentName,
+			fmt.Sprintf("%d", ag.AID),
+			ag.Name,
+		}
+
+		ch <- prometheus.MustNewConstMetric(
+			ThousandTestDNSResolutionTimeDesc,
+			prometheus.GaugeValue,
+			float64(r.ResolutionTime),
+			labels...,
+		)
+
+		errorType := r.errorType()
+		available := 1.0
+		if errorType != "" {
+			available = 0
+			ch <- prometheus.MustNewConstMetric(
+				ThousandTestDNSErrorInfoDesc,
+				prometheus.GaugeValue,
+				1,
+				append(labels, errorType)...,
+			)
+		}
+		ch <- prometheus.MustNewConstMetric(
+			ThousandTestDNSAvailableDesc,
+			prometheus.GaugeValue,
+			available,
+			labels...,
+		)
+	}
+}
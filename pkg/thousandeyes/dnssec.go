@@ -0,0 +1,149 @@
+package thousandeyes
+
+import (
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"log"
+)
+
+const (
+	apiURLTestDNSSEC   = "https://api.thousandeyes.com/v6/dns/dnssec/%d.json"
+	apiURLv7TestDNSSEC = "https://api.thousandeyes.com/v7/test-results/%d/dnssec"
+)
+
+// dnssecTestLabels are the labels of DNSSEC test metrics
+var dnssecTestLabels = []string{"test_id", "test_name", "type", "domain", "country", "agent_name", "account_group_id", "account_group_name"}
+
+var (
+	// - dnssec tests
+	ThousandTestDNSSECValidDesc = prometheus.NewDesc(
+		"thousandeyes_test_dnssec_valid",
+		"DNSSEC test ran in ThousandEyes - 1 if the agent validated the DNSSEC chain of the domain, 0 otherwise.",
+		dnssecTestLabels,
+		nil)
+	ThousandTestDNSSECInfoDesc = prometheus.NewDesc(
+		"thousandeyes_test_dnssec_info",
+		"DNSSEC test ran in ThousandEyes - always 1, the error or validation message of the agent is the label message.",
+		append(append([]string{}, dnssecTestLabels...), "message"),
+		nil)
+)
+
+//https://api.thousandeyes.com/v6/dns/dnssec/612434.json
+
+// DNSSECTestResults DNSSEC test details
+type DNSSECTestResults struct {
+	DNS struct {
+		Test   ThousandTest   `json:"test"`
+		DNSSEC []DNSSECResult `json:"dnssec"`
+	} `json:"dns"`
+	Pages Pages `json:"pages"`
+	// AccountGroup the test belongs to
+	AccountGroup AccountGroup `json:"-"`
+}
+
+// DNSSECResult DNSSEC validation of an agent
+type DNSSECResult struct {
+	Valid        int    `json:"valid"`
+	ErrorDetails string `json:"errorDetails"`
+	AgentName    string `json:"agentName"`
+	CountryID    string `json:"countryId"`
+	Date         string `json:"date"`
+	AgentID      int    `json:"agentId"`
+	RoundID      int    `json:"roundId"`
+}
+
+func (r *DNSSECTestResults) nextPage() string { return r.Pages.Next }
+func (r *DNSSECTestResults) appendPage(page interface{}) {
+	r.DNS.DNSSEC = append(r.DNS.DNSSEC, page.(*DNSSECTestResults).DNS.DNSSEC...)
+}
+
+// v7 has a boolean valid
+type v7DNSSECResults struct {
+	Test    v7Test `json:"test"`
+	Results []struct {
+		DNSSECResult
+		Valid   bool   `json:"valid"`
+		AgentID string `json:"agentId"`
+	} `json:"results"`
+	Links v7Links `json:"_links"`
+}
+
+func (r *v7DNSSECResults) nextPage() string { return r.Links.Next.Href }
+func (r *v7DNSSECResults) appendPage(page interface{}) {
+	r.Results = append(r.Results, page.(*v7DNSSECResults).Results...)
+}
+
+func (r *v7DNSSECResults) result(ctx *TestContext) interface{} {
+	res := new(DNSSECTestResults)
+	res.DNS.Test = r.Test.toV6()
+	for _, m := range r.Results {
+		dnssec := m.DNSSECResult
+		if m.Valid {
+			dnssec.Valid = 1
+		}
+		dnssec.AgentID = v7ID(m.AgentID)
+		agent := ctx.v7Agent(m.AgentID)
+		dnssec.AgentName = agent.AgentName
+		dnssec.CountryID = agent.CountryID
+		res.DNS.DNSSEC = append(res.DNS.DNSSEC, dnssec)
+	}
+	return res
+}
+
+// newDNSSECHandler collects the validation results of dnssec tests
+func newDNSSECHandler() TestHandler {
+	return resultHandler{
+		handlerInfo: handlerInfo{
+			family:    FamilyDNSSEC,
+			testTypes: []string{"dnssec"},
+			descs: []*prometheus.Desc{
+				ThousandTestDNSSECValidDesc,
+				ThousandTestDNSSECInfoDesc,
+			},
+		},
+		requests: resultRequests{
+			APIVersion6: {apiURLTestDNSSEC, func() interface{} { return new(DNSSECTestResults) }},
+			APIVersion7: {apiURLv7TestDNSSEC, func() interface{} { return new(v7DNSSECResults) }},
+		},
+		collect: collectDNSSEC,
+	}
+}
+
+func collectDNSSEC(tDNSSEC []DNSSECTestResults, ch chan<- prometheus.Metric) {
+
+	for e := range tDNSSEC {
+		if len(tDNSSEC[e].DNS.DNSSEC) == 0 {
+			log.Println("INFO: DNSSEC metrics are empty for Test:", tDNSSEC[e])
+			continue
+		}
+		test := tDNSSEC[e].DNS.Test
+		ag := tDNSSEC[e].AccountGroup
+
+		for _, r := range tDNSSEC[e].DNS.DNSSEC {
+
+			labels := []string{
+				fmt.Sprintf("%d", test.TestID),
+				test.TestName,
+				test.Type,
+				test.Domain,
+				r.CountryID,
+				r.AgentName,
+				fmt.Sprintf("%d", ag.AID),
+				ag.Name,
+			}
+
+			ch <- prometheus.MustNewConstMetric(
+				ThousandTestDNSSECValidDesc,
+				prometheus.GaugeValue,
+				float64(r.Valid),
+				labels...,
+			)
+			ch <- prometheus.MustNewConstMetric(
+				ThousandTestDNSSECInfoDesc,
+				prometheus.GaugeValue,
+				1,
+				append(labels, r.ErrorDetails)...,
+			)
+		}
+	}
+}
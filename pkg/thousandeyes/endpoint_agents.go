@@ -0,0 +1,368 @@
+package thousandeyes
+
+import (
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"log"
+	"strings"
+)
+
+const (
+	apiURLEndpointAgents     = "https://api.thousandeyes.com/v6/endpoint-agents.json"
+	apiURLEndpointTests      = "https://api.thousandeyes.com/v6/endpoint-tests.json"
+	apiURLEndpointNetMetrics = "https://api.thousandeyes.com/v6/endpoint-data/tests/net/metrics/%d.json"
+)
+
+// labels the endpoint agent series can be aggregated by, see Collector.EndpointAggregateBy
+const (
+	EndpointAggregateLocation = "location"
+	EndpointAggregateNetwork  = "network"
+	EndpointAggregateAgent    = "agent"
+)
+
+// endpointGroupLabels are set as selected by the aggregation, the labels not aggregated by are empty
+var endpointGroupLabels = []string{"location", "network", "agent_name"}
+
+var endpointTestLabels = append([]string{"test_id", "test_name", "target"}, endpointGroupLabels...)
+
+var (
+	// - endpoint agents, aggregated - one series per laptop does not belong into Prometheus
+	ThousandEndpointAgentsDesc = prometheus.NewDesc(
+		"thousandeyes_endpoint_agents",
+		"Endpoint agents in ThousandEyes - number of agents per status. The network is not known for the agents, it is empty.",
+		append(append([]string{}, endpointGroupLabels...), "status", "account_group_id", "account_group_name"),
+		nil)
+	ThousandEndpointTestAvgLatencyDesc = prometheus.NewDesc(
+		"thousandeyes_endpoint_test_avg_latency_milliseconds",
+		"Scheduled endpoint test ran in ThousandEyes - mean of metric avgLatency of the agents.",
+		append(append([]string{}, endpointTestLabels...), "account_group_id", "account_group_name"),
+		nil)
+	ThousandEndpointTestLossDesc = prometheus.NewDesc(
+		"thousandeyes_endpoint_test_loss_percentage",
+		"Scheduled endpoint test ran in ThousandEyes - mean of metric loss of the agents.",
+		append(append([]string{}, endpointTestLabels...), "account_group_id", "account_group_name"),
+		nil)
+	ThousandEndpointTestAgentsDesc = prometheus.NewDesc(
+		"thousandeyes_endpoint_test_agents",
+		"Scheduled endpoint test ran in ThousandEyes - number of agents the means are built of.",
+		append(append([]string{}, endpointTestLabels...), "account_group_id", "account_group_name"),
+		nil)
+	ThousandEndpointWifiQualityDesc = prometheus.NewDesc(
+		"thousandeyes_endpoint_wifi_signal_quality_percentage",
+		"Endpoint agents in ThousandEyes - mean Wi-Fi signal quality seen by the scheduled endpoint tests.",
+		append(append([]string{}, endpointGroupLabels...), "account_group_id", "account_group_name"),
+		nil)
+	ThousandEndpointWifiRSSIDesc = prometheus.NewDesc(
+		"thousandeyes_endpoint_wifi_rssi_dbm",
+		"Endpoint agents in ThousandEyes - mean Wi-Fi RSSI seen by the scheduled endpoint tests.",
+		append(append([]string{}, endpointGroupLabels...), "account_group_id", "account_group_name"),
+		nil)
+)
+
+//https://api.thousandeyes.com/v6/endpoint-agents.json
+
+// EndpointAgents describes the JSON returned by a request of the endpoint agents of an account group
+type EndpointAgents struct {
+	EndpointAgents []EndpointAgent `json:"endpointAgents"`
+	Pages          Pages           `json:"pages"`
+}
+
+// EndpointAgent is an endpoint agent installed on a computer of a user
+type EndpointAgent struct {
+	AgentID      string `json:"agentId"`
+	AgentName    string `json:"agentName"`
+	ComputerName string `json:"computerName"`
+	Status       string `json:"status"`
+	LastSeen     string `json:"lastSeen"`
+	Location     struct {
+		LocationName string `json:"locationName"`
+	} `json:"location"`
+}
+
+// EndpointTests describes the JSON returned by a request of the scheduled endpoint tests
+type EndpointTests struct {
+	EndpointTests []EndpointTest `json:"endpointTests"`
+	Pages         Pages          `json:"pages"`
+}
+
+// EndpointTest is a scheduled endpoint test
+type EndpointTest struct {
+	TestID   int    `json:"testId"`
+	TestName string `json:"testName"`
+	Type     string `json:"type"`
+	Server   string `json:"server"`
+	Interval int    `json:"interval"`
+}
+
+//https://api.thousandeyes.com/v6/endpoint-data/tests/net/metrics/612434.json
+
+// EndpointNetResults network results of a scheduled endpoint test
+type EndpointNetResults struct {
+	EndpointNet struct {
+		Test    EndpointTest        `json:"test"`
+		Metrics []EndpointNetMetric `json:"metrics"`
+	} `json:"endpointNet"`
+	Pages Pages `json:"pages"`
+}
+
+// EndpointTestResults are the network metrics of a scheduled endpoint test,
+// Test is the test as listed, the test of the result response is not used for the labels
+type EndpointTestResults struct {
+	Test    EndpointTest
+	Metrics []EndpointNetMetric
+}
+
+// EndpointNetMetric network metrics of an endpoint agent and the network it was connected to
+type EndpointNetMetric struct {
+	AgentID        string                 `json:"agentId"`
+	AvgLatency     float32                `json:"avgLatency"`
+	Loss           float32                `json:"loss"`
+	NetworkProfile EndpointNetworkProfile `json:"networkProfile"`
+	RoundID        int                    `json:"roundId"`
+}
+
+// EndpointNetworkProfile WirelessProfile is set if the agent was connected by Wi-Fi
+type EndpointNetworkProfile struct {
+	InterfaceType   string                   `json:"interfaceType"`
+	WirelessProfile *EndpointWirelessProfile `json:"wirelessProfile,omitempty"`
+}
+
+// EndpointWirelessProfile is the Wi-Fi network of an endpoint agent
+type EndpointWirelessProfile struct {
+	SSID    string  `json:"ssid"`
+	RSSI    float32 `json:"rssi"`
+	Quality float32 `json:"quality"`
+}
+
+func (r *EndpointAgents) nextPage() string { return r.Pages.Next }
+func (r *EndpointAgents) appendPage(page interface{}) {
+	r.EndpointAgents = append(r.EndpointAgents, page.(*EndpointAgents).EndpointAgents...)
+}
+
+func (r *EndpointTests) nextPage() string { return r.Pages.Next }
+func (r *EndpointTests) appendPage(page interface{}) {
+	r.EndpointTests = append(r.EndpointTests, page.(*EndpointTests).EndpointTests...)
+}
+
+func (r *EndpointNetResults) nextPage() string { return r.Pages.Next }
+func (r *EndpointNetResults) appendPage(page interface{}) {
+	r.EndpointNet.Metrics = append(r.EndpointNet.Metrics, page.(*EndpointNetResults).EndpointNet.Metrics...)
+}
+
+// network is the SSID for Wi-Fi, the interface type otherwise
+func (p EndpointNetworkProfile) network() string {
+	if p.WirelessProfile != nil && p.WirelessProfile.SSID != "" {
+		return p.WirelessProfile.SSID
+	}
+	return p.InterfaceType
+}
+
+// EndpointData are the endpoint agents and the results of the scheduled endpoint tests of an account group
+type EndpointData struct {
+	Agents       []EndpointAgent
+	Results      []EndpointTestResults
+	AccountGroup AccountGroup
+	// AggregateBy see Collector.EndpointAggregateBy
+	AggregateBy []string
+}
+
+// GetEndpointData fetches the endpoint agents and the network results of all scheduled endpoint tests, API v6 only
+func (t *Collector) GetEndpointData(ag AccountGroup) (EndpointData, bool, bool) {
+	data := EndpointData{AccountGroup: ag, AggregateBy: t.endpointAggregateBy()}
+
+	requests := []Request{
+		{URL: withAccountGroup(apiURLEndpointAgents, ag), ResponseObject: new(EndpointAgents)},
+		{URL: withAccountGroup(apiURLEndpointTests, ag), ResponseObject: new(EndpointTests)},
+	}
+	bHitAPILimit, bError := CallSequence(t.Token, t.User, t.IsBasicAuth, t.MaxPages, t.retries, requests)
+	for _, r := range requests {
+		bError = bError || r.Error != nil
+	}
+	if bError {
+		return data, bHitAPILimit, bError
+	}
+	data.Agents = requests[0].ResponseObject.(*EndpointAgents).EndpointAgents
+
+	tests := requests[1].ResponseObject.(*EndpointTests).EndpointTests
+	var resultRequests []Request
+	for _, test := range tests {
+		resultRequests = append(resultRequests, Request{
+			URL:            withAccountGroup(fmt.Sprintf(apiURLEndpointNetMetrics, test.TestID), ag),
+			ResponseObject: new(EndpointNetResults),
+		})
+	}
+	// a failed result request fails its test only, not the refresh: the error is logged and counted
+	// (thousandeyes_api_failures_total) by CallSingle already and the other tests are collected nevertheless
+	bHitAPILimit, _ = CallParallel(t.Token, t.User, t.IsBasicAuth, t.MaxParallelRequests, t.MaxPages, t.retries, resultRequests)
+	failed := 0
+	for i, r := range resultRequests {
+		if r.Error != nil {
+			failed++
+			continue
+		}
+		data.Results = append(data.Results, EndpointTestResults{
+			Test:    tests[i],
+			Metrics: r.ResponseObject.(*EndpointNetResults).EndpointNet.Metrics,
+		})
+	}
+	if failed > 0 {
+		log.Printf("ERROR: Results of %d of %d endpoint tests could not be fetched, they are left out (account group: %s)", failed, len(resultRequests), ag.Name)
+	}
+	return data, bHitAPILimit, false
+}
+
+func (t *Collector) endpointAggregateBy() []string {
+	if len(t.EndpointAggregateBy) == 0 {
+		return []string{EndpointAggregateLocation}
+	}
+	return t.EndpointAggregateBy
+}
+
+func validateEndpointAggregateBy(aggregateBy []string) error {
+	for _, a := range aggregateBy {
+		switch a {
+		case EndpointAggregateLocation, EndpointAggregateNetwork, EndpointAggregateAgent:
+		default:
+			return fmt.Errorf("unknown aggregation %q (%s|%s|%s)", a, EndpointAggregateLocation, EndpointAggregateNetwork, EndpointAggregateAgent)
+		}
+	}
+	return nil
+}
+
+// groupLabels are the values of endpointGroupLabels, empty for the labels not aggregated by
+func (d EndpointData) groupLabels(location, network, agentName string) []string {
+	labels := make([]string, len(endpointGroupLabels))
+	if d.aggregatesBy(EndpointAggregateLocation) {
+		labels[0] = location
+	}
+	if d.aggregatesBy(EndpointAggregateNetwork) {
+		labels[1] = network
+	}
+	if d.aggregatesBy(EndpointAggregateAgent) {
+		labels[2] = agentName
+	}
+	return labels
+}
+
+func (d EndpointData) aggregatesBy(label string) bool {
+	for _, a := range d.AggregateBy {
+		if a == label {
+			return true
+		}
+	}
+	return false
+}
+
+// endpointGroup sums up the samples of the agents of a group
+type endpointGroup struct {
+	labels  []string
+	agents  map[string]bool
+	samples int
+	latency float64
+	loss    float64
+	quality float64
+	rssi    float64
+}
+
+// endpointGroups keeps the groups in the order they were seen
+type endpointGroups struct {
+	groups []*endpointGroup
+	byKey  map[string]*endpointGroup
+}
+
+func (g *endpointGroups) get(labels []string) *endpointGroup {
+	if g.byKey == nil {
+		g.byKey = map[string]*endpointGroup{}
+	}
+	key := strings.Join(labels, "\x00")
+	group, ok := g.byKey[key]
+	if !ok {
+		group = &endpointGroup{labels: labels, agents: map[string]bool{}}
+		g.byKey[key] = group
+		g.groups = append(g.groups, group)
+	}
+	return group
+}
+
+func collectEndpointData(d EndpointData, ch chan<- prometheus.Metric) {
+
+	agLabels := []string{fmt.Sprintf("%d", d.AccountGroup.AID), d.AccountGroup.Name}
+
+	agents := map[string]EndpointAgent{}
+	var statuses endpointGroups
+	for _, a := range d.Agents {
+		agents[a.AgentID] = a
+		statuses.get(append(d.groupLabels(a.Location.LocationName, "", a.AgentName), a.Status)).samples++
+	}
+	for _, g := range statuses.groups {
+		ch <- prometheus.MustNewConstMetric(
+			ThousandEndpointAgentsDesc,
+			prometheus.GaugeValue,
+			float64(g.samples),
+			append(append([]string{}, g.labels...), agLabels...)...,
+		)
+	}
+
+	var wifi endpointGroups
+	for _, r := range d.Results {
+		test := r.Test
+		testLabels := []string{fmt.Sprintf("%d", test.TestID), test.TestName, test.Server}
+
+		var groups endpointGroups
+		for _, m := range r.Metrics {
+			a := agents[m.AgentID]
+			labels := d.groupLabels(a.Location.LocationName, m.NetworkProfile.network(), a.AgentName)
+
+			g := groups.get(labels)
+			g.agents[m.AgentID] = true
+			g.samples++
+			g.latency += float64(m.AvgLatency)
+			g.loss += float64(m.Loss)
+
+			if p := m.NetworkProfile.WirelessProfile; p != nil {
+				w := wifi.get(labels)
+				w.samples++
+				w.quality += float64(p.Quality)
+				w.rssi += float64(p.RSSI)
+			}
+		}
+
+		for _, g := range groups.groups {
+			labels := append(append(append([]string{}, testLabels...), g.labels...), agLabels...)
+			ch <- prometheus.MustNewConstMetric(
+				ThousandEndpointTestAvgLatencyDesc,
+				prometheus.GaugeValue,
+				g.latency/float64(g.samples),
+				labels...,
+			)
+			ch <- prometheus.MustNewConstMetric(
+				ThousandEndpointTestLossDesc,
+				prometheus.GaugeValue,
+				g.loss/float64(g.samples),
+				labels...,
+			)
+			ch <- prometheus.MustNewConstMetric(
+				ThousandEndpointTestAgentsDesc,
+				prometheus.GaugeValue,
+				float64(len(g.agents)),
+				labels...,
+			)
+		}
+	}
+
+	for _, w := range wifi.groups {
+		labels := append(append([]string{}, w.labels...), agLabels...)
+		ch <- prometheus.MustNewConstMetric(
+			ThousandEndpointWifiQualityDesc,
+			prometheus.GaugeValue,
+			w.quality/float64(w.samples),
+			labels...,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			ThousandEndpointWifiRSSIDesc,
+			prometheus.GaugeValue,
+			w.rssi/float64(w.samples),
+			labels...,
+		)
+	}
+}
@@ -0,0 +1,173 @@
+package thousandeyes
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestCollectEndpointDataAggregation(t *testing.T) {
+	agent := func(id, name, location string) EndpointAgent {
+		a := EndpointAgent{AgentID: id, AgentName: name, Status: "enabled"}
+		a.Location.LocationName = location
+		return a
+	}
+	wifi := func(id string, latency float32, ssid string) EndpointNetMetric {
+		m := EndpointNetMetric{AgentID: id, AvgLatency: latency}
+		m.NetworkProfile.InterfaceType = "wireless"
+		m.NetworkProfile.WirelessProfile = &EndpointWirelessProfile{SSID: ssid}
+		return m
+	}
+
+	data := EndpointData{
+		Agents: []EndpointAgent{
+			agent("a1", "laptop-1", "Berlin"),
+			agent("a2", "laptop-2", "Berlin"),
+			agent("a3", "laptop-3", "Paris"),
+		},
+		Results: []EndpointTestResults{{
+			Test: EndpointTest{TestID: 7, TestName: "intranet", Server: "intranet.example.com"},
+			Metrics: []EndpointNetMetric{
+				wifi("a1", 10, "corp"),
+				wifi("a2", 20, "corp"),
+				{AgentID: "a3", AvgLatency: 30, NetworkProfile: EndpointNetworkProfile{InterfaceType: "ethernet"}},
+			},
+		}},
+	}
+
+	// the keys are location/network/agent_name
+	tests := []struct {
+		aggregateBy []string
+		wantLatency map[string]float64
+		wantAgents  map[string]float64
+	}{
+		{
+			[]string{EndpointAggregateLocation},
+			map[string]float64{"Berlin//": 15, "Paris//": 30},
+			map[string]float64{"Berlin//": 2, "Paris//": 1},
+		},
+		{
+			[]string{EndpointAggregateNetwork},
+			map[string]float64{"/corp/": 15, "/ethernet/": 30},
+			map[string]float64{"/corp/": 2, "/ethernet/": 1},
+		},
+		{
+			[]string{EndpointAggregateAgent},
+			map[string]float64{"//laptop-1": 10, "//laptop-2": 20, "//laptop-3": 30},
+			map[string]float64{"//laptop-1": 1, "//laptop-2": 1, "//laptop-3": 1},
+		},
+		{
+			[]string{EndpointAggregateLocation, EndpointAggregateNetwork},
+			map[string]float64{"Berlin/corp/": 15, "Paris/ethernet/": 30},
+			map[string]float64{"Berlin/corp/": 2, "Paris/ethernet/": 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.aggregateBy, ","), func(t *testing.T) {
+			d := data
+			d.AggregateBy = tt.aggregateBy
+
+			registry := prometheus.NewRegistry()
+			registry.MustRegister(collectorFunc(func(ch chan<- prometheus.Metric) {
+				collectEndpointData(d, ch)
+			}))
+			families, err := registry.Gather()
+			if err != nil {
+				t.Fatalf("gather: %s", err)
+			}
+
+			got := map[string]map[string]float64{}
+			for _, f := range families {
+				got[f.GetName()] = map[string]float64{}
+				for _, m := range f.Metric {
+					l := map[string]string{}
+					for _, p := range m.Label {
+						l[p.GetName()] = p.GetValue()
+					}
+					if name, ok := l["test_name"]; ok && name != "intranet" {
+						t.Errorf("test_name %q, want the name of the listed test", name)
+					}
+					got[f.GetName()][l["location"]+"/"+l["network"]+"/"+l["agent_name"]] = m.Gauge.GetValue()
+				}
+			}
+
+			for name, want := range map[string]map[string]float64{
+				"thousandeyes_endpoint_test_avg_latency_milliseconds": tt.wantLatency,
+				"thousandeyes_endpoint_test_agents":                   tt.wantAgents,
+			} {
+				if len(got[name]) != len(want) {
+					t.Errorf("%s: %v, want %v", name, got[name], want)
+					continue
+				}
+				for key, v := range want {
+					if got[name][key] != v {
+						t.Errorf("%s{%s}: %v, want %v", name, key, got[name][key], v)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestGetEndpointDataSkipsFailedTests(t *testing.T) {
+	const testList = `{"endpointTests": [{"testId": 1, "testName": "intranet"}, {"testId": 2, "testName": "deleted"}, {"testId": 3, "testName": "mail"}]}`
+	const metrics = `{"endpointNet": {"metrics": [{"agentId": "a1", "avgLatency": 10}]}}`
+
+	tests := []struct {
+		name      string
+		bodies    map[string]string
+		wantError bool
+		wantTests []int
+	}{
+		{
+			"a failed test is left out",
+			map[string]string{
+				"/v6/endpoint-agents.json":                   `{"endpointAgents": [{"agentId": "a1"}]}`,
+				"/v6/endpoint-tests.json":                    testList,
+				"/v6/endpoint-data/tests/net/metrics/1.json": metrics,
+				"/v6/endpoint-data/tests/net/metrics/3.json": metrics,
+			},
+			false,
+			[]int{1, 3},
+		},
+		{
+			"the agent list failed",
+			map[string]string{
+				"/v6/endpoint-tests.json":                    testList,
+				"/v6/endpoint-data/tests/net/metrics/1.json": metrics,
+			},
+			true,
+			nil,
+		},
+		{
+			"the test list failed",
+			map[string]string{
+				"/v6/endpoint-agents.json": `{"endpointAgents": [{"agentId": "a1"}]}`,
+			},
+			true,
+			nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			redirectAPI(t, newTestAPI(t, tt.bodies))
+
+			c := &Collector{Token: "token"}
+			data, _, bError := c.GetEndpointData(AccountGroup{})
+			if bError != tt.wantError {
+				t.Fatalf("error %t, want %t", bError, tt.wantError)
+			}
+			var got []int
+			for _, r := range data.Results {
+				got = append(got, r.Test.TestID)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.wantTests) {
+				t.Errorf("tests %v, want %v", got, tt.wantTests)
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package thousandeyes
+
+const (
+	apiURLTestFTPServer   = "https://api.thousandeyes.com/v6/web/ftp-server/%d.json"
+	apiURLv7TestFTPServer = "https://api.thousandeyes.com/v7/test-results/%d/ftp-server"
+)
+
+// - ftp server tests
+var ThousandTestFTPServerDescs = newServerTestDescs("ftp", "FTP server")
+
+//https://api.thousandeyes.com/v6/web/ftp-server/612434.json
+
+// FTPServerTestResults FTP server test details
+type FTPServerTestResults struct {
+	Web struct {
+		Test      ThousandTest   `json:"test"`
+		FTPServer []ServerResult `json:"ftpServer"`
+	} `json:"web"`
+	Pages Pages `json:"pages"`
+}
+
+func (r *FTPServerTestResults) nextPage() string { return r.Pages.Next }
+func (r *FTPServerTestResults) appendPage(page interface{}) {
+	r.Web.FTPServer = append(r.Web.FTPServer, page.(*FTPServerTestResults).Web.FTPServer...)
+}
+
+func (r *FTPServerTestResults) result(ctx *TestContext) interface{} {
+	return &ServerTestResults{Test: r.Web.Test, Results: r.Web.FTPServer}
+}
+
+// newFTPServerHandler collects the results of ftp-server tests
+func newFTPServerHandler() TestHandler {
+	return newServerTestHandler(FamilyFTPServer, "ftp-server", ThousandTestFTPServerDescs,
+		resultRequest{apiURLTestFTPServer, func() interface{} { return new(FTPServerTestResults) }},
+		apiURLv7TestFTPServer)
+}
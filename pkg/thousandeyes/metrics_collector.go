@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/prometheus/client_golang/prometheus"
 	"log"
+	"sync"
 	"time"
 )
 
@@ -14,111 +15,138 @@ var (
 	ThousandAlertDesc = prometheus.NewDesc(
 		"thousandeyes_alert",
 		"triggered / active alerts for a rule in ThousandEyes.",
-		[]string{"test_name", "type", "rule_name", "rule_expression"},
+		[]string{"test_name", "type", "rule_name", "rule_expression", "account_group_id", "account_group_name"},
 		nil)
 	ThousandAlertHTMLReachabilitySuccessRatioDesc = prometheus.NewDesc(
 		"thousandeyes_alert_html_reachability_ratio",
 		"Reachability Success Ratio Gauge defined by: 1 - ViolationCount / MonitorCount ",
-		[]string{"test_name", "type", "rule_name", "rule_expression"},
+		[]string{"test_name", "type", "rule_name", "rule_expression", "account_group_id", "account_group_name"},
+		nil)
+	ThousandAlertStartDesc = prometheus.NewDesc(
+		"thousandeyes_alert_start_timestamp_seconds",
+		"triggered / active alerts for a rule in ThousandEyes - time the alert started.",
+		[]string{"alert_id", "test_name", "type", "rule_name", "account_group_id", "account_group_name"},
+		nil)
+	ThousandAlertEndDesc = prometheus.NewDesc(
+		"thousandeyes_alert_end_timestamp_seconds",
+		"triggered / active alerts for a rule in ThousandEyes - time the alert ended, not set while the alert is active.",
+		[]string{"alert_id", "test_name", "type", "rule_name", "account_group_id", "account_group_name"},
+		nil)
+	ThousandAlertDurationDesc = prometheus.NewDesc(
+		"thousandeyes_alert_duration_seconds",
+		"triggered / active alerts for a rule in ThousandEyes - time from the start to the end of the alert, up to now while the alert is active.",
+		[]string{"alert_id", "test_name", "type", "rule_name", "account_group_id", "account_group_name"},
 		nil)
 	// - bgp tests
 	ThousandTestBGPReachabilityDesc = prometheus.NewDesc(
 		"thousandeyes_test_bgp_reachability_percentage",
 		"BGP test ran in ThousandEyes - metric: reachability.",
-		[]string{"test_id", "test_name", "type", "prefix", "country", "monitor_name"},
+		[]string{"test_id", "test_name", "type", "prefix", "country", "monitor_name", "account_group_id", "account_group_name"},
 		nil)
 	//ThousandTestBGPUpdatesDesc
 	ThousandTestBGPUpdatesDesc = prometheus.NewDesc(
 		"thousandeyes_test_bgp_updates",
 		"BGP test ran in ThousandEyes - metric: updates.",
-		[]string{"test_id", "test_name", "type", "prefix", "country", "monitor_name"},
+		[]string{"test_id", "test_name", "type", "prefix", "country", "monitor_name", "account_group_id", "account_group_name"},
 		nil)
 	ThousandTestBGPPathChangesDesc = prometheus.NewDesc(
 		"thousandeyes_test_bgp_path_changes",
 		"BGP test ran in ThousandEyes - metric: pathChanges.",
-		[]string{"test_id", "test_name", "type", "prefix", "country", "monitor_name"},
+		[]string{"test_id", "test_name", "type", "prefix", "country", "monitor_name", "account_group_id", "account_group_name"},
 		nil)
 
 	// - html tests web
 	ThousandTestHTMLconnectTimeDesc = prometheus.NewDesc(
 		"thousandeyes_test_html_avg_connect_time_milliseconds",
 		"HTML test ran in ThousandEyes - metric: connectTime.",
-		[]string{"test_id","test_name", "type", "prefix", "country", "agent_name"},
+		[]string{"test_id","test_name", "type", "prefix", "country", "agent_name", "account_group_id", "account_group_name"},
 		nil)
 	//ThousandTestHTMLDNSTimeDesc
 	ThousandTestHTMLDNSTimeDesc = prometheus.NewDesc(
 		"thousandeyes_test_html_avg_dns_time_milliseconds",
 		"HTML test ran in ThousandEyes - metric: dnsTime.",
-		[]string{"test_id","test_name", "type", "prefix", "country", "agent_name"},
+		[]string{"test_id","test_name", "type", "prefix", "country", "agent_name", "account_group_id", "account_group_name"},
 		nil)
 	//ThousandTestHTMLRedirectsDesc
 	ThousandTestHTMLRedirectsDesc = prometheus.NewDesc(
 		"thousandeyes_test_html_num_redirects",
 		"HTML test ran in ThousandEyes - metric: NumRedirects.",
-		[]string{"test_id","test_name", "type", "prefix", "country", "agent_name"},
+		[]string{"test_id","test_name", "type", "prefix", "country", "agent_name", "account_group_id", "account_group_name"},
 		nil)
 	//ThousandTestHTMLreceiveTimeDesc
 	ThousandTestHTMLreceiveTimeDesc = prometheus.NewDesc(
 		"thousandeyes_test_html_receiveTime_milliseconds",
 		"HTML test ran in ThousandEyes - metric: receiveTime.",
-		[]string{"test_id","test_name", "type", "prefix", "country", "agent_name"},
+		[]string{"test_id","test_name", "type", "prefix", "country", "agent_name", "account_group_id", "account_group_name"},
 		nil)
 	//ThousandTestHTMLresponseCodeDesc
 	ThousandTestHTMLresponseCodeDesc = prometheus.NewDesc(
 		"thousandeyes_test_html_response_code",
 		"HTML test ran in ThousandEyes - metric: responseCode.",
-		[]string{"test_id","test_name", "type", "prefix", "country", "agent_name"},
+		[]string{"test_id","test_name", "type", "prefix", "country", "agent_name", "account_group_id", "account_group_name"},
 		nil)
 	ThousandTestHTMLresponseTimeDesc = prometheus.NewDesc(
 		"thousandeyes_test_html_response_time_milliseconds",
 		"HTML test ran in ThousandEyes - metric: responseTime.",
-		[]string{"test_id","test_name", "type", "prefix", "country", "agent_name"},
+		[]string{"test_id","test_name", "type", "prefix", "country", "agent_name", "account_group_id", "account_group_name"},
 		nil)
 	//ThousandTestHTMLTotalTimeDesc
 	ThousandTestHTMLTotalTimeDesc = prometheus.NewDesc(
 		"thousandeyes_test_html_total_time_milliseconds",
 		"HTML test ran in ThousandEyes - metric: totalTime.",
-		[]string{"test_id","test_name", "type", "prefix", "country", "agent_name"},
+		[]string{"test_id","test_name", "type", "prefix", "country", "agent_name", "account_group_id", "account_group_name"},
 		nil)
 	ThousandTestHTMLwaitTimeDesc = prometheus.NewDesc(
 		"thousandeyes_test_html_wait_time_milliseconds",
 		"HTML test ran in ThousandEyes - metric: waitTime.",
-		[]string{"test_id","test_name", "type", "prefix", "country", "agent_name"},
+		[]string{"test_id","test_name", "type", "prefix", "country", "agent_name", "account_group_id", "account_group_name"},
 		nil)
 	ThousandTestHTMLwireSizeDesc = prometheus.NewDesc(
 		"thousandeyes_test_html_wire_size_byte",
 		"HTML test ran in ThousandEyes - metric: wireSize.",
-		[]string{"test_id","test_name", "type", "prefix", "country", "agent_name"},
+		[]string{"test_id","test_name", "type", "prefix", "country", "agent_name", "account_group_id", "account_group_name"},
 		nil)
 
 	// - html tests metrics
 	ThousandTestHTMLLossDesc = prometheus.NewDesc(
 		"thousandeyes_test_html_loss_percentage",
 		"HTML test ran in ThousandEyes - metric: loss.",
-		[]string{"test_id","test_name", "type", "prefix", "country", "agent_name"},
+		[]string{"test_id","test_name", "type", "prefix", "country", "agent_name", "account_group_id", "account_group_name"},
 		nil)
 	//ThousandTestHTMLAvgLatencyDesc
 	ThousandTestHTMLAvgLatencyDesc = prometheus.NewDesc(
 		"thousandeyes_test_html_avg_latency_milliseconds",
 		"HTML test ran in ThousandEyes - metric: avgLatency.",
-		[]string{"test_id","test_name", "type", "prefix", "country", "agent_name"},
+		[]string{"test_id","test_name", "type", "prefix", "country", "agent_name", "account_group_id", "account_group_name"},
 		nil)
 	//ThousandTestHTMLMinLatencyDesc
 	ThousandTestHTMLMinLatencyDesc = prometheus.NewDesc(
 		"thousandeyes_test_html_min_latency_milliseconds",
 		"HTML test ran in ThousandEyes - metric: minLatency.",
-		[]string{"test_id","test_name", "type", "prefix", "country", "agent_name"},
+		[]string{"test_id","test_name", "type", "prefix", "country", "agent_name", "account_group_id", "account_group_name"},
 		nil)
 	ThousandTestHTMLMaxLatencyDesc = prometheus.NewDesc(
 		"thousandeyes_test_html_max_latency_milliseconds",
 		"HTML test ran in ThousandEyes - metric: maxLatency.",
-		[]string{"test_id","test_name", "type", "prefix", "country", "agent_name"},
+		[]string{"test_id","test_name", "type", "prefix", "country", "agent_name", "account_group_id", "account_group_name"},
 		nil)
 	//ThousandTestHTMLJitterDesc
 	ThousandTestHTMLJitterDesc = prometheus.NewDesc(
 		"thousandeyes_test_html_jitter_milliseconds",
 		"HTML test ran in ThousandEyes - metric: jitter.",
-		[]string{"test_id","test_name", "type", "prefix", "country", "agent_name"},
+		[]string{"test_id","test_name", "type", "prefix", "country", "agent_name", "account_group_id", "account_group_name"},
+		nil)
+
+	// - test selection
+	ThousandTestsDiscoveredDesc = prometheus.NewDesc(
+		"thousandeyes_tests_discovered",
+		"Number of tests ThousandEyes returned for the account group.",
+		[]string{"account_group_id", "account_group_name"},
+		nil)
+	ThousandTestsSelectedDesc = prometheus.NewDesc(
+		"thousandeyes_tests_selected",
+		"Number of tests selected by the test filter, only their details are fetched.",
+		[]string{"account_group_id", "account_group_name"},
 		nil)
 
 	// fixed metrics
@@ -141,15 +169,67 @@ var (
 		Name: "thousandeyes_scraping_seconds",
 		Help: "The number of scraping time in seconds.",
 	})
-	//ThousandRequestAPILimitReached
-	ThousandRequestAPILimitReached = prometheus.NewGauge(prometheus.GaugeOpts{
-		Name: "thousandeyes_api_request_limit_reached",
-		Help: "0 no, 1 hit limit. Request not complete. Tests Details skipped first",
+	//ThousandRequestAPILimitRemaining
+	ThousandRequestAPILimitRemaining = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "thousandeyes_api_request_limit_remaining",
+		Help: "Requests left in the current ThousandEyes API rate limit window of the organisation (X-Organization-Rate-Limit-Remaining).",
+	})
+	//ThousandRequestAPILimit
+	ThousandRequestAPILimit = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "thousandeyes_api_request_limit",
+		Help: "Requests per minute allowed for the organisation by the ThousandEyes API (X-Organization-Rate-Limit-Limit).",
 	})
 	ThousandRequestsetRospectionPeriodMetric = prometheus.NewGauge(prometheus.GaugeOpts{
 		Name: "thousandeyes_retrospection_period_seconds",
 		Help: "The number of seconds into the past we query ThousandEyes for.",
 	})
+	//ThousandAPIRetriesMetric
+	ThousandAPIRetriesMetric = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "thousandeyes_api_retries_total",
+		Help: "The number of retried requests against ThousandEyes API by http status code or transport error (timeout, connection_reset).",
+	}, []string{"code"})
+	//ThousandAPIFailuresMetric
+	ThousandAPIFailuresMetric = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "thousandeyes_api_failures_total",
+		Help: "The number of requests against ThousandEyes API failed finally (not retryable or retries exhausted) by http status code or transport error.",
+	}, []string{"code"})
+	//ThousandAPIPagesMetric
+	ThousandAPIPagesMetric = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "thousandeyes_api_pages_total",
+		Help: "The number of pages fetched from ThousandEyes API per endpoint.",
+	}, []string{"endpoint"})
+	//ThousandAPIPagesTruncatedMetric
+	ThousandAPIPagesTruncatedMetric = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "thousandeyes_api_pages_truncated_total",
+		Help: "The number of paginated requests against ThousandEyes API stopped at max_pages per endpoint, the following pages are skipped.",
+	}, []string{"endpoint"})
+	//ThousandConfigLastReloadSuccessful
+	ThousandConfigLastReloadSuccessful = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "thousandeyes_config_last_reload_successful",
+		Help: "0 failed, 1 succeeded. Result of the last load of the config file.",
+	})
+	//ThousandConfigLastReloadSuccessTimestamp
+	ThousandConfigLastReloadSuccessTimestamp = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "thousandeyes_config_last_reload_success_timestamp_seconds",
+		Help: "Timestamp of the last successful load of the config file.",
+	})
+	//ThousandConfigHash
+	ThousandConfigHash = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "thousandeyes_config_hash",
+		Help: "Hash of the config file in use.",
+	})
+	//ThousandLastRefreshSuccess
+	ThousandLastRefreshSuccess = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "thousandeyes_last_refresh_success",
+		Help: "0 failed, 1 succeeded. Result of the last background refresh of the snapshot per family (alerts, tests).",
+	}, []string{"family"})
+
+	// - snapshot, computed on every scrape
+	ThousandSnapshotAgeDesc = prometheus.NewDesc(
+		"thousandeyes_snapshot_age_seconds",
+		"Seconds since the snapshot served on /metrics was last refreshed successfully from the ThousandEyes API.",
+		[]string{"family"},
+		nil)
 
 	// stuff for 1000 eyes API
 	RetrospectionPeriod = flag.Duration(
@@ -160,6 +240,28 @@ var (
 	//bearerToken = flag.String("Token", "NOT SET", "Bearer Token of 1oooEyes")
 )
 
+// agentTestLabels are the labels of test metrics measured by an agent, the same as the HTML test metrics have
+var agentTestLabels = []string{"test_id", "test_name", "type", "prefix", "country", "agent_name", "account_group_id", "account_group_name"}
+
+// agentTestLabelValues are the values of agentTestLabels
+func agentTestLabelValues(test ThousandTest, countryID string, agentName string, ag AccountGroup) []string {
+	return []string{
+		fmt.Sprintf("%d", test.TestID),
+		test.TestName,
+		test.Type,
+		test.Prefix,
+		countryID,
+		agentName,
+		fmt.Sprintf("%d", ag.AID),
+		ag.Name,
+	}
+}
+
+// isErrorType is false for the error types ThousandEyes reports if there was no error
+func isErrorType(errorType string) bool {
+	return errorType != "" && errorType != "None"
+}
+
 //type ThousandEyes struct {
 //	Token string
 //}
@@ -170,35 +272,84 @@ type Collector struct {
 	Token string
 	User string
 	//tbd: RefreshToken string
-	IsCollectBgp bool
-	IsCollectHttp bool
-	IsCollectHttpMetrics bool
+	// TestHandlers collect the test results, see Config.NewCollector
+	TestHandlers []TestHandler
+	// IsCollectAgents adds the agents of the account groups (thousandeyes_agent_*)
+	IsCollectAgents bool
+	// IsCollectEndpointAgents adds the endpoint agents and their scheduled tests (thousandeyes_endpoint_*), API v6 only
+	IsCollectEndpointAgents bool
+	// EndpointAggregateBy are the labels the endpoint series are aggregated by (location|network|agent), location if not set
+	EndpointAggregateBy []string
+	// Timezone of the account, the v6 API gives dates without zone, UTC if not set
+	Timezone *time.Location
+	// IsCollectAlertRules adds the alert rules and the tests they are assigned to (thousandeyes_alert_rule_*)
+	IsCollectAlertRules bool
+	// ExpectedOriginAS maps prefixes to the AS expected to originate them
+	ExpectedOriginAS map[string]int
+	// AccountGroups selects the account groups to scrape, default is the default group of the token
+	AccountGroups AccountGroupSelection
+	// TestFilter restricts the tests whose details are fetched, all tests if empty
+	TestFilter TestFilter
+	// ProbeModules are the modules usable on /probe
+	ProbeModules map[string]ProbeModule
+	// PollInterval is the time between two background refreshes of the snapshot
+	PollInterval time.Duration
+	// TestsPollInterval is the time between two refreshes of the test results, PollInterval if not set
+	TestsPollInterval time.Duration
+	// AccountGroupsPollInterval is the time the account groups are cached, defaultAccountGroupsPollInterval if not set
+	AccountGroupsPollInterval time.Duration
+	// MaxParallelRequests limits the test detail requests running at the same time, no limit if not set
+	MaxParallelRequests int
+	// MaxPages caps the pages fetched for one paginated request, DefaultMaxPages if not set
+	MaxPages int
+	// MaxTransactionSteps limits the distinct step names exported per transaction test, defaultMaxTransactionSteps if not set
+	MaxTransactionSteps int
+	// APIVersion is the ThousandEyes API version used (v6|v7), v6 if not set
+	APIVersion string
+
+	mu       sync.RWMutex
+	snapshot snapshot
+
+	accountGroupsCache accountGroupsCache
+
+	// retries is the retry budget of the running refresh (or /probe request), replaced by every refresh
+	retries *RetryBudget
 }
 
 func (t *Collector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- ThousandAlertDesc
 	ch <- ThousandAlertHTMLReachabilitySuccessRatioDesc
+	ch <- ThousandAlertStartDesc
+	ch <- ThousandAlertEndDesc
+	ch <- ThousandAlertDurationDesc
+	ch <- ThousandAlertAgentDesc
+	ch <- ThousandAlertAgentInfoDesc
+	ch <- ThousandAlertMonitorDesc
+	ch <- ThousandAlertMonitorInfoDesc
+
+	for _, h := range t.TestHandlers {
+		h.Describe(ch)
+	}
+
+	ch <- ThousandTestsDiscoveredDesc
+	ch <- ThousandTestsSelectedDesc
+
+	ch <- ThousandAgentInfoDesc
+	ch <- ThousandAgentUpDesc
+	ch <- ThousandAgentLastSeenDesc
+	ch <- ThousandAgentUtilizationDesc
 
-	ch <- ThousandTestBGPReachabilityDesc
-	ch <- ThousandTestBGPUpdatesDesc
-	ch <- ThousandTestBGPPathChangesDesc
-
-	ch <- ThousandTestHTMLLossDesc
-	ch <- ThousandTestHTMLAvgLatencyDesc
-	ch <- ThousandTestHTMLMinLatencyDesc
-	ch <- ThousandTestHTMLMaxLatencyDesc
-	ch <- ThousandTestHTMLJitterDesc
-
-	ch <- ThousandTestHTMLconnectTimeDesc
-	ch <- ThousandTestHTMLDNSTimeDesc
-	ch <- ThousandTestHTMLRedirectsDesc
-	ch <- ThousandTestHTMLreceiveTimeDesc
-	ch <- ThousandTestHTMLresponseCodeDesc
-	ch <- ThousandTestHTMLresponseTimeDesc
-	ch <- ThousandTestHTMLTotalTimeDesc
-	ch <- ThousandTestHTMLwaitTimeDesc
-	ch <- ThousandTestHTMLwireSizeDesc
+	ch <- ThousandEndpointAgentsDesc
+	ch <- ThousandEndpointTestAvgLatencyDesc
+	ch <- ThousandEndpointTestLossDesc
+	ch <- ThousandEndpointTestAgentsDesc
+	ch <- ThousandEndpointWifiQualityDesc
+	ch <- ThousandEndpointWifiRSSIDesc
 
+	ch <- ThousandAlertRuleInfoDesc
+	ch <- ThousandAlertRuleTestDesc
+
+	ch <- ThousandSnapshotAgeDesc
 }
 func addStaticMetrics(ch chan<- prometheus.Metric){
 	ch <- ThousandRequestsTotalMetric
@@ -206,25 +357,20 @@ func addStaticMetrics(ch chan<- prometheus.Metric){
 	ch <- ThousandRequestParsingFailMetric
 	ch <- ThousandRequestsetRospectionPeriodMetric
 	ch <- ThousandRequestScrapingTime
-	ch <- ThousandRequestAPILimitReached
+	ch <- ThousandRequestAPILimitRemaining
+	ch <- ThousandRequestAPILimit
+	ThousandLastRefreshSuccess.Collect(ch)
+	ch <- ThousandConfigLastReloadSuccessful
+	ch <- ThousandConfigLastReloadSuccessTimestamp
+	ch <- ThousandConfigHash
+	ThousandAPIRetriesMetric.Collect(ch)
+	ThousandAPIFailuresMetric.Collect(ch)
+	ThousandAPIPagesMetric.Collect(ch)
+	ThousandAPIPagesTruncatedMetric.Collect(ch)
+	ch <- ThousandTestTransactionStepsDroppedMetric
 }
 
-func collectAlerts(c Collector, ch chan<- prometheus.Metric) {
-
-	t, bHitRateLimit, bError  :=  c.GetAlerts()
-
-	// hint for the limit
-	if bHitRateLimit {
-		ThousandRequestAPILimitReached.Set(1)
-	} else {
-		ThousandRequestAPILimitReached.Set(0)
-	}
-
-	// if we hit the api request limit in between we skip the test details
-	if bError {
-		ThousandRequestsFailMetric.Inc()
-		return
-	}
+func collectAlerts(t ThousandAlerts, ch chan<- prometheus.Metric) {
 
 	a := t.Alert
 	for i := range a {
@@ -238,6 +384,8 @@ func collectAlerts(c Collector, ch chan<- prometheus.Metric) {
 			a[i].Type,
 			a[i].RuleName,
 			a[i].RuleExpression,
+			fmt.Sprintf("%d", t.AccountGroup.AID),
+			t.AccountGroup.Name,
 		)
 
 		// skip thousandeyes_parsing_fails for non BGP alerts
@@ -253,27 +401,82 @@ func collectAlerts(c Collector, ch chan<- prometheus.Metric) {
 				a[i].Type,
 				a[i].RuleName,
 				a[i].RuleExpression,
+				fmt.Sprintf("%d", t.AccountGroup.AID),
+				t.AccountGroup.Name,
 			)
 		}
 
+		collectAlertTimes(a[i], t.AccountGroup, t.Timezone, ch)
+		collectAlertBreakdown(a[i], t.AccountGroup, ch)
 	}
 }
-func collectTests(c Collector, ch chan<- prometheus.Metric) {
 
-	tBGP, tHTMLm, tHTMLw, bHitRateLimit, bError := c.GetTests()
+// collectAlertTimes the end is only known for alerts which are not active anymore
+func collectAlertTimes(a ThousandAlert, ag AccountGroup, loc *time.Location, ch chan<- prometheus.Metric) {
 
-	// hint for the limit
-	if bHitRateLimit {
-		ThousandRequestAPILimitReached.Set(1)
-	} else {
-		ThousandRequestAPILimitReached.Set(0)
+	start, ok := parseThousandDate(a.DateStart, loc)
+	if !ok {
+		return
+	}
+	labels := []string{
+		fmt.Sprintf("%d", a.AlertID),
+		a.TestName,
+		a.Type,
+		a.RuleName,
+		fmt.Sprintf("%d", ag.AID),
+		ag.Name,
 	}
 
-	// if we hit the api request limit in between we skip the test details
-	if bError {
-		ThousandRequestsFailMetric.Inc()
-		return
+	ch <- prometheus.MustNewConstMetric(
+		ThousandAlertStartDesc,
+		prometheus.GaugeValue,
+		float64(start.Unix()),
+		labels...,
+	)
+
+	end := time.Now()
+	if a.DateEnd != "" {
+		var ok bool
+		if end, ok = parseThousandDate(a.DateEnd, loc); !ok {
+			return
+		}
+		ch <- prometheus.MustNewConstMetric(
+			ThousandAlertEndDesc,
+			prometheus.GaugeValue,
+			float64(end.Unix()),
+			labels...,
+		)
 	}
+	ch <- prometheus.MustNewConstMetric(
+		ThousandAlertDurationDesc,
+		prometheus.GaugeValue,
+		end.Sub(start).Seconds(),
+		labels...,
+	)
+}
+func collectTests(r TestResults, handlers []TestHandler, ch chan<- prometheus.Metric) {
+
+	for _, c := range r.Counts {
+		ch <- prometheus.MustNewConstMetric(
+			ThousandTestsDiscoveredDesc,
+			prometheus.GaugeValue,
+			float64(c.Discovered),
+			fmt.Sprintf("%d", c.AccountGroup.AID),
+			c.AccountGroup.Name,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			ThousandTestsSelectedDesc,
+			prometheus.GaugeValue,
+			float64(c.Selected),
+			fmt.Sprintf("%d", c.AccountGroup.AID),
+			c.AccountGroup.Name,
+		)
+	}
+
+	collectHandlerResults(r, handlers, ch)
+}
+
+func collectBGP(tBGP []BGPTestResults, ch chan<- prometheus.Metric) {
 
 	for e := range tBGP {
 
@@ -298,6 +501,8 @@ func collectTests(c Collector, ch chan<- prometheus.Metric) {
 				tBGP[e].Net.BgpMetrics[i].Prefix,
 				tBGP[e].Net.BgpMetrics[i].CountryID,
 				tBGP[e].Net.BgpMetrics[i].MonitorName,
+				fmt.Sprintf("%d", tBGP[e].AccountGroup.AID),
+				tBGP[e].AccountGroup.Name,
 			)
 			ch <- prometheus.MustNewConstMetric(
 				ThousandTestBGPUpdatesDesc,
@@ -309,6 +514,8 @@ func collectTests(c Collector, ch chan<- prometheus.Metric) {
 				tBGP[e].Net.BgpMetrics[i].Prefix,
 				tBGP[e].Net.BgpMetrics[i].CountryID,
 				tBGP[e].Net.BgpMetrics[i].MonitorName,
+				fmt.Sprintf("%d", tBGP[e].AccountGroup.AID),
+				tBGP[e].AccountGroup.Name,
 			)
 			ch <- prometheus.MustNewConstMetric(
 				ThousandTestBGPPathChangesDesc,
@@ -320,9 +527,14 @@ func collectTests(c Collector, ch chan<- prometheus.Metric) {
 				tBGP[e].Net.BgpMetrics[i].Prefix,
 				tBGP[e].Net.BgpMetrics[i].CountryID,
 				tBGP[e].Net.BgpMetrics[i].MonitorName,
+				fmt.Sprintf("%d", tBGP[e].AccountGroup.AID),
+				tBGP[e].AccountGroup.Name,
 			)
 		}
 	}
+}
+
+func collectHTTPMetrics(tHTMLm []HTTPTestMetricResults, ch chan<- prometheus.Metric) {
 
 	for e := range tHTMLm {
 
@@ -343,6 +555,8 @@ func collectTests(c Collector, ch chan<- prometheus.Metric) {
 				tHTMLm[e].Net.Test.Prefix,
 				tHTMLm[e].Net.HTTPMetrics[i].CountryID,
 				tHTMLm[e].Net.HTTPMetrics[i].AgentName,
+				fmt.Sprintf("%d", tHTMLm[e].AccountGroup.AID),
+				tHTMLm[e].AccountGroup.Name,
 			)
 			ch <- prometheus.MustNewConstMetric(
 				ThousandTestHTMLMinLatencyDesc,
@@ -354,6 +568,8 @@ func collectTests(c Collector, ch chan<- prometheus.Metric) {
 				tHTMLm[e].Net.Test.Prefix,
 				tHTMLm[e].Net.HTTPMetrics[i].CountryID,
 				tHTMLm[e].Net.HTTPMetrics[i].AgentName,
+				fmt.Sprintf("%d", tHTMLm[e].AccountGroup.AID),
+				tHTMLm[e].AccountGroup.Name,
 			)
 			ch <- prometheus.MustNewConstMetric(
 				ThousandTestHTMLMaxLatencyDesc,
@@ -365,6 +581,8 @@ func collectTests(c Collector, ch chan<- prometheus.Metric) {
 				tHTMLm[e].Net.Test.Prefix,
 				tHTMLm[e].Net.HTTPMetrics[i].CountryID,
 				tHTMLm[e].Net.HTTPMetrics[i].AgentName,
+				fmt.Sprintf("%d", tHTMLm[e].AccountGroup.AID),
+				tHTMLm[e].AccountGroup.Name,
 			)
 			ch <- prometheus.MustNewConstMetric(
 				ThousandTestHTMLLossDesc,
@@ -376,6 +594,8 @@ func collectTests(c Collector, ch chan<- prometheus.Metric) {
 				tHTMLm[e].Net.Test.Prefix,
 				tHTMLm[e].Net.HTTPMetrics[i].CountryID,
 				tHTMLm[e].Net.HTTPMetrics[i].AgentName,
+				fmt.Sprintf("%d", tHTMLm[e].AccountGroup.AID),
+				tHTMLm[e].AccountGroup.Name,
 			)
 			ch <- prometheus.MustNewConstMetric(
 				ThousandTestHTMLJitterDesc,
@@ -387,9 +607,14 @@ func collectTests(c Collector, ch chan<- prometheus.Metric) {
 				tHTMLm[e].Net.Test.Prefix,
 				tHTMLm[e].Net.HTTPMetrics[i].CountryID,
 				tHTMLm[e].Net.HTTPMetrics[i].AgentName,
+				fmt.Sprintf("%d", tHTMLm[e].AccountGroup.AID),
+				tHTMLm[e].AccountGroup.Name,
 			)
 		}
 	}
+}
+
+func collectHTTPWeb(tHTMLw []HTTPTestWebServerResults, ch chan<- prometheus.Metric) {
 
 	for e := range tHTMLw {
 		if len(tHTMLw[e].Web.HTTPServer) == 0 {
@@ -408,6 +633,8 @@ func collectTests(c Collector, ch chan<- prometheus.Metric) {
 				tHTMLw[e].Web.Test.Prefix,
 				tHTMLw[e].Web.HTTPServer[i].CountryID,
 				tHTMLw[e].Web.HTTPServer[i].AgentName,
+				fmt.Sprintf("%d", tHTMLw[e].AccountGroup.AID),
+				tHTMLw[e].AccountGroup.Name,
 			)
 			ch <- prometheus.MustNewConstMetric(
 				ThousandTestHTMLDNSTimeDesc,
@@ -419,6 +646,8 @@ func collectTests(c Collector, ch chan<- prometheus.Metric) {
 				tHTMLw[e].Web.Test.Prefix,
 				tHTMLw[e].Web.HTTPServer[i].CountryID,
 				tHTMLw[e].Web.HTTPServer[i].AgentName,
+				fmt.Sprintf("%d", tHTMLw[e].AccountGroup.AID),
+				tHTMLw[e].AccountGroup.Name,
 			)
 			ch <- prometheus.MustNewConstMetric(
 				ThousandTestHTMLRedirectsDesc,
@@ -430,6 +659,8 @@ func collectTests(c Collector, ch chan<- prometheus.Metric) {
 				tHTMLw[e].Web.Test.Prefix,
 				tHTMLw[e].Web.HTTPServer[i].CountryID,
 				tHTMLw[e].Web.HTTPServer[i].AgentName,
+				fmt.Sprintf("%d", tHTMLw[e].AccountGroup.AID),
+				tHTMLw[e].AccountGroup.Name,
 			)
 			ch <- prometheus.MustNewConstMetric(
 				ThousandTestHTMLreceiveTimeDesc,
@@ -441,6 +672,8 @@ func collectTests(c Collector, ch chan<- prometheus.Metric) {
 				tHTMLw[e].Web.Test.Prefix,
 				tHTMLw[e].Web.HTTPServer[i].CountryID,
 				tHTMLw[e].Web.HTTPServer[i].AgentName,
+				fmt.Sprintf("%d", tHTMLw[e].AccountGroup.AID),
+				tHTMLw[e].AccountGroup.Name,
 			)
 			ch <- prometheus.MustNewConstMetric(
 				ThousandTestHTMLresponseCodeDesc,
@@ -452,6 +685,8 @@ func collectTests(c Collector, ch chan<- prometheus.Metric) {
 				tHTMLw[e].Web.Test.Prefix,
 				tHTMLw[e].Web.HTTPServer[i].CountryID,
 				tHTMLw[e].Web.HTTPServer[i].AgentName,
+				fmt.Sprintf("%d", tHTMLw[e].AccountGroup.AID),
+				tHTMLw[e].AccountGroup.Name,
 			)
 			ch <- prometheus.MustNewConstMetric(
 				ThousandTestHTMLresponseTimeDesc,
@@ -463,6 +698,8 @@ func collectTests(c Collector, ch chan<- prometheus.Metric) {
 				tHTMLw[e].Web.Test.Prefix,
 				tHTMLw[e].Web.HTTPServer[i].CountryID,
 				tHTMLw[e].Web.HTTPServer[i].AgentName,
+				fmt.Sprintf("%d", tHTMLw[e].AccountGroup.AID),
+				tHTMLw[e].AccountGroup.Name,
 			)
 			ch <- prometheus.MustNewConstMetric(
 				ThousandTestHTMLTotalTimeDesc,
@@ -474,6 +711,8 @@ func collectTests(c Collector, ch chan<- prometheus.Metric) {
 				tHTMLw[e].Web.Test.Prefix,
 				tHTMLw[e].Web.HTTPServer[i].CountryID,
 				tHTMLw[e].Web.HTTPServer[i].AgentName,
+				fmt.Sprintf("%d", tHTMLw[e].AccountGroup.AID),
+				tHTMLw[e].AccountGroup.Name,
 			)
 			ch <- prometheus.MustNewConstMetric(
 				ThousandTestHTMLwaitTimeDesc,
@@ -485,6 +724,8 @@ func collectTests(c Collector, ch chan<- prometheus.Metric) {
 				tHTMLw[e].Web.Test.Prefix,
 				tHTMLw[e].Web.HTTPServer[i].CountryID,
 				tHTMLw[e].Web.HTTPServer[i].AgentName,
+				fmt.Sprintf("%d", tHTMLw[e].AccountGroup.AID),
+				tHTMLw[e].AccountGroup.Name,
 			)
 			ch <- prometheus.MustNewConstMetric(
 				ThousandTestHTMLwireSizeDesc,
@@ -496,17 +737,18 @@ func collectTests(c Collector, ch chan<- prometheus.Metric) {
 				tHTMLw[e].Web.Test.Prefix,
 				tHTMLw[e].Web.HTTPServer[i].CountryID,
 				tHTMLw[e].Web.HTTPServer[i].AgentName,
+				fmt.Sprintf("%d", tHTMLw[e].AccountGroup.AID),
+				tHTMLw[e].AccountGroup.Name,
 			)
 		}
 	}
-
 }
 
-func (t Collector) Collect(ch chan<- prometheus.Metric) {
+// Collect serves the metrics from the snapshot kept by the background poller (see Run),
+// it does not call the ThousandEyes API itself
+func (t *Collector) Collect(ch chan<- prometheus.Metric) {
 	defer addStaticMetrics(ch)
 
-	scrapeStart := time.Now()
-
 	defer func() {
 		if r := recover(); r != nil {
 			ThousandRequestParsingFailMetric.Inc()
@@ -514,16 +756,20 @@ func (t Collector) Collect(ch chan<- prometheus.Metric) {
 		}
 	}()
 
-	collectAlerts(t, ch)
-	if  t.IsCollectBgp ||
-		t.IsCollectHttp ||
-		t.IsCollectHttpMetrics {
-		collectTests(t, ch)
-	}
-
-
-	scrapeElapsed := time.Since(scrapeStart)
-
-	ThousandRequestScrapingTime.Add(scrapeElapsed.Seconds())
+	s := t.getSnapshot()
 
+	collectSnapshotAge(s, ch)
+	for i := range s.alerts {
+		collectAlerts(s.alerts[i], ch)
+	}
+	collectTests(s.tests, t.TestHandlers, ch)
+	for i := range s.agents {
+		collectAgents(s.agents[i], ch)
+	}
+	for i := range s.endpoint {
+		collectEndpointData(s.endpoint[i], ch)
+	}
+	for i := range s.alertRules {
+		collectAlertRules(s.alertRules[i], ch)
+	}
 }
@@ -0,0 +1,59 @@
+package thousandeyes
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestCollectAlertTimes(t *testing.T) {
+	berlin := time.FixedZone("CEST", 2*60*60)
+	start := time.Date(2020, 6, 1, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name         string
+		alert        ThousandAlert
+		wantEnd      bool
+		wantDuration float64
+	}{
+		{"ended", ThousandAlert{DateStart: "2020-06-01 12:00:00", DateEnd: "2020-06-01 12:30:00"}, true, 30 * 60},
+		{"active", ThousandAlert{DateStart: "2020-06-01 12:00:00"}, false, time.Since(start).Seconds()},
+		{"start not a date", ThousandAlert{DateStart: "yesterday"}, false, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := prometheus.NewRegistry()
+			registry.MustRegister(collectorFunc(func(ch chan<- prometheus.Metric) {
+				collectAlertTimes(tt.alert, AccountGroup{}, berlin, ch)
+			}))
+			families, err := registry.Gather()
+			if err != nil {
+				t.Fatalf("gather: %s", err)
+			}
+
+			values := map[string]float64{}
+			for _, f := range families {
+				values[f.GetName()] = f.GetMetric()[0].GetGauge().GetValue()
+			}
+
+			if tt.wantDuration == 0 {
+				if len(values) != 0 {
+					t.Errorf("metrics %v, want none", values)
+				}
+				return
+			}
+			if got := values["thousandeyes_alert_start_timestamp_seconds"]; got != float64(start.Unix()) {
+				t.Errorf("start %v, want %v", got, start.Unix())
+			}
+			if _, ok := values["thousandeyes_alert_end_timestamp_seconds"]; ok != tt.wantEnd {
+				t.Errorf("end exported %t, want %t", ok, tt.wantEnd)
+			}
+			// the duration of an active alert grows while the test runs
+			if got := values["thousandeyes_alert_duration_seconds"]; got < tt.wantDuration || got > tt.wantDuration+60 {
+				t.Errorf("duration %v, want %v", got, tt.wantDuration)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package thousandeyes
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"log"
+)
+
+// agent-to-server tests use the net/metrics endpoint and HTTPTestMetricResults like the network metrics of http-server tests,
+// their metrics are not prefixed "html" though
+
+// networkTestLabels have the server_ip in addition, an agent measures every target of the test
+var networkTestLabels = append(append([]string{}, agentTestLabels...), "server_ip")
+
+var (
+	// - agent-to-server tests
+	ThousandTestNetworkLossDesc = prometheus.NewDesc(
+		"thousandeyes_test_network_loss_percentage",
+		"Agent to server test ran in ThousandEyes - metric: loss.",
+		networkTestLabels,
+		nil)
+	ThousandTestNetworkAvgLatencyDesc = prometheus.NewDesc(
+		"thousandeyes_test_network_avg_latency_milliseconds",
+		"Agent to server test ran in ThousandEyes - metric: avgLatency.",
+		networkTestLabels,
+		nil)
+	ThousandTestNetworkMinLatencyDesc = prometheus.NewDesc(
+		"thousandeyes_test_network_min_latency_milliseconds",
+		"Agent to server test ran in ThousandEyes - metric: minLatency.",
+		networkTestLabels,
+		nil)
+	ThousandTestNetworkMaxLatencyDesc = prometheus.NewDesc(
+		"thousandeyes_test_network_max_latency_milliseconds",
+		"Agent to server test ran in ThousandEyes - metric: maxLatency.",
+		networkTestLabels,
+		nil)
+	ThousandTestNetworkJitterDesc = prometheus.NewDesc(
+		"thousandeyes_test_network_jitter_milliseconds",
+		"Agent to server test ran in ThousandEyes - metric: jitter.",
+		networkTestLabels,
+		nil)
+)
+
+// networkRequests are the requests of the network results of http-server and agent-to-server tests
+var networkRequests = resultRequests{
+	APIVersion6: {apiURLTestHTTPMetrics, func() interface{} { return new(HTTPTestMetricResults) }},
+	APIVersion7: {apiURLv7TestNetwork, func() interface{} { return new(v7NetworkResults) }},
+}
+
+// newNetworkHandler collects the network metrics of agent-to-server tests
+func newNetworkHandler() TestHandler {
+	return resultHandler{
+		handlerInfo: handlerInfo{
+			family:    FamilyNetwork,
+			testTypes: []string{"agent-to-server"},
+			descs: []*prometheus.Desc{
+				ThousandTestNetworkLossDesc,
+				ThousandTestNetworkAvgLatencyDesc,
+				ThousandTestNetworkMinLatencyDesc,
+				ThousandTestNetworkMaxLatencyDesc,
+				ThousandTestNetworkJitterDesc,
+			},
+		},
+		requests: networkRequests,
+		collect:  collectNetwork,
+	}
+}
+
+func collectNetwork(tNetwork []HTTPTestMetricResults, ch chan<- prometheus.Metric) {
+
+	for e := range tNetwork {
+		if len(tNetwork[e].Net.HTTPMetrics) == 0 {
+			log.Println("INFO: Network metrics are empty for Test:", tNetwork[e])
+			continue
+		}
+		for _, m := range tNetwork[e].Net.HTTPMetrics {
+
+			labels := append(agentTestLabelValues(tNetwork[e].Net.Test, m.CountryID, m.AgentName, tNetwork[e].AccountGroup), m.ServerIP)
+
+			ch <- prometheus.MustNewConstMetric(
+				ThousandTestNetworkLossDesc,
+				prometheus.GaugeValue,
+				float64(m.Loss),
+				labels...,
+			)
+			ch <- prometheus.MustNewConstMetric(
+				ThousandTestNetworkAvgLatencyDesc,
+				prometheus.GaugeValue,
+				float64(m.AvgLatency),
+				labels...,
+			)
+			ch <- prometheus.MustNewConstMetric(
+				ThousandTestNetworkMinLatencyDesc,
+				prometheus.GaugeValue,
+				float64(m.MinLatency),
+				labels...,
+			)
+			ch <- prometheus.MustNewConstMetric(
+				ThousandTestNetworkMaxLatencyDesc,
+				prometheus.GaugeValue,
+				float64(m.MaxLatency),
+				labels...,
+			)
+			ch <- prometheus.MustNewConstMetric(
+				ThousandTestNetworkJitterDesc,
+				prometheus.GaugeValue,
+				float64(m.Jitter),
+				labels...,
+			)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package thousandeyes
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// collectorFunc registers a collect function, the registry checks the series for duplicates
+type collectorFunc func(ch chan<- prometheus.Metric)
+
+func (f collectorFunc) Describe(ch chan<- *prometheus.Desc) {}
+func (f collectorFunc) Collect(ch chan<- prometheus.Metric) { f(ch) }
+
+func TestCollectNetworkServers(t *testing.T) {
+	var res HTTPTestMetricResults
+	res.Net.Test = ThousandTest{TestID: 1, TestName: "dns servers", Type: "agent-to-server"}
+	res.Net.HTTPMetrics = []HTTPMetric{
+		{AgentName: "Frankfurt", ServerIP: "192.0.2.1", Loss: 1},
+		{AgentName: "Frankfurt", ServerIP: "192.0.2.2", Loss: 2},
+		{AgentName: "Tokyo", ServerIP: "192.0.2.1", Loss: 3},
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collectorFunc(func(ch chan<- prometheus.Metric) {
+		collectNetwork([]HTTPTestMetricResults{res}, ch)
+	}))
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("series of a test with more than one target: %s", err)
+	}
+
+	for _, f := range families {
+		if f.GetName() != "thousandeyes_test_network_loss_percentage" {
+			continue
+		}
+		if len(f.Metric) != len(res.Net.HTTPMetrics) {
+			t.Fatalf("%d loss series, want %d", len(f.Metric), len(res.Net.HTTPMetrics))
+		}
+		for _, m := range f.Metric {
+			var agent, server string
+			for _, l := range m.Label {
+				switch l.GetName() {
+				case "agent_name":
+					agent = l.GetValue()
+				case "server_ip":
+					server = l.GetValue()
+				}
+			}
+			for _, want := range res.Net.HTTPMetrics {
+				if want.AgentName == agent && want.ServerIP == server && float64(want.Loss) != m.Gauge.GetValue() {
+					t.Errorf("loss of %s to %s is %v, want %v", agent, server, m.Gauge.GetValue(), want.Loss)
+				}
+			}
+		}
+		return
+	}
+	t.Errorf("no loss series")
+}
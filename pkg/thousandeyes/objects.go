@@ -25,66 +25,134 @@ type Request struct {
 
 // ThousandAlerts describes the JSON returned by a request active alerts to ThousandEyes
 type ThousandAlerts struct {
-	From  string `json:"from"`
-	Alert []struct {
-		Active    int    `json:"active"`
-		AlertID   int    `json:"alertId"`
-		DateEnd   string `json:"dateEnd,omitempty"`
-		DateStart string `json:"dateStart"`
-		Monitors  []struct { //array of monitors where the alert has at some point been active since the point that the alert was triggered. Only shown on BGP alerts.
-			Active         int    `json:"active"`
-			MetricsAtStart string `json:"metricsAtStart"`
-			MetricsAtEnd   string `json:"metricsAtEnd"`
-			MonitorID      int    `json:"monitorId"`
-			MonitorName    string `json:"monitorName"`
-			PrefixID       int    `json:"prefixId"`
-			Prefix         string `json:"prefix"`
-			DateStart      string `json:"dateStart"`
-			DateEnd        string `json:"dateEnd"`
-			Permalink      string `json:"permalink"`
-			Network        string `json:"network"`
-		} `json:"monitors,omitempty"`
-		Permalink      string `json:"permalink"`
-		RuleExpression string `json:"ruleExpression"`
-		RuleID         int    `json:"ruleId"`
-		RuleName       string `json:"ruleName"`
-		TestID         int    `json:"testId"`
-		TestName       string `json:"testName"`
-		ViolationCount int    `json:"violationCount"`
-		Type           string `json:"type"`
-		APILinks       []struct {
-			Rel  string `json:"rel"`
-			Href string `json:"href"`
-		} `json:"apiLinks,omitempty"`
-		Agents []struct { //array of monitors where the alert has at some point been active since the point that the alert was triggered. Not shown on BGP alerts.
-			Active         int    `json:"active"`
-			MetricsAtStart string `json:"metricsAtStart"`
-			MetricsAtEnd   string `json:"metricsAtEnd"`
-			AgentID        int    `json:"agentId"`
-			AgentName      string `json:"agentName"`
-			DateStart      string `json:"dateStart"`
-			DateEnd        string `json:"dateEnd"`
-			Permalink      string `json:"permalink"`
-		} `json:"agents,omitempty"`
-	} `json:"alert"`
-	Pages struct {
-		Current int `json:"current"`
-	} `json:"pages"`
+	From  string          `json:"from"`
+	Alert []ThousandAlert `json:"alert"`
+	Pages Pages           `json:"pages"`
+	// AccountGroup the alerts were requested for
+	AccountGroup AccountGroup `json:"-"`
+	// Timezone of the dates of the account, see parseThousandDate
+	Timezone *time.Location `json:"-"`
+}
+
+// ThousandAlert is a single alert
+type ThousandAlert struct {
+	Active         int            `json:"active"`
+	AlertID        int            `json:"alertId"`
+	DateEnd        string         `json:"dateEnd,omitempty"`
+	DateStart      string         `json:"dateStart"`
+	Monitors       []AlertMonitor `json:"monitors,omitempty"` //array of monitors where the alert has at some point been active since the point that the alert was triggered. Only shown on BGP alerts.
+	Permalink      string         `json:"permalink"`
+	RuleExpression string         `json:"ruleExpression"`
+	RuleID         int            `json:"ruleId"`
+	RuleName       string         `json:"ruleName"`
+	TestID         int            `json:"testId"`
+	TestName       string         `json:"testName"`
+	ViolationCount int            `json:"violationCount"`
+	Type           string         `json:"type"`
+	APILinks       []struct {
+		Rel  string `json:"rel"`
+		Href string `json:"href"`
+	} `json:"apiLinks,omitempty"`
+	Agents []AlertAgent `json:"agents,omitempty"` //array of agents where the alert has at some point been active since the point that the alert was triggered. Not shown on BGP alerts.
+}
+
+// AlertMonitor is a BGP monitor of an alert
+type AlertMonitor struct {
+	Active         int    `json:"active"`
+	MetricsAtStart string `json:"metricsAtStart"`
+	MetricsAtEnd   string `json:"metricsAtEnd"`
+	MonitorID      int    `json:"monitorId"`
+	MonitorName    string `json:"monitorName"`
+	PrefixID       int    `json:"prefixId"`
+	Prefix         string `json:"prefix"`
+	DateStart      string `json:"dateStart"`
+	DateEnd        string `json:"dateEnd"`
+	Permalink      string `json:"permalink"`
+	Network        string `json:"network"`
+}
+
+// AlertAgent is an agent of an alert
+type AlertAgent struct {
+	Active         int    `json:"active"`
+	MetricsAtStart string `json:"metricsAtStart"`
+	MetricsAtEnd   string `json:"metricsAtEnd"`
+	AgentID        int    `json:"agentId"`
+	AgentName      string `json:"agentName"`
+	DateStart      string `json:"dateStart"`
+	DateEnd        string `json:"dateEnd"`
+	Permalink      string `json:"permalink"`
+}
+
+// Pages is the pagination info of a ThousandEyes response, Next is the URL of the following page if there is one
+type Pages struct {
+	Current int    `json:"current"`
+	Next    string `json:"next,omitempty"`
 }
 
 //ThousandTests describes needed Fields from the JSON returned by a request  to ThousandEyes
 type ThousandTests struct {
 	Tests []ThousandTest `json:"test"`
+	Pages Pages          `json:"pages"`
 }
 
 //ThousandTest in detail
 type ThousandTest struct {
-	TestID   int    `json:"testId"`
-	TestName string `json:"testName"`
-	Type     string `json:"type"`
-	Prefix   string `json:"prefix"`
-	Interval int    `json:"interval"`
-	URL      string `json:"url"`
+	TestID   int         `json:"testId"`
+	TestName string      `json:"testName"`
+	Type     string      `json:"type"`
+	Prefix   string      `json:"prefix"`
+	Interval int         `json:"interval"`
+	URL      string      `json:"url"`
+	Domain   string      `json:"domain,omitempty"`
+	Groups   []TestGroup `json:"groups,omitempty"`
+	// TargetAgentID is the target of agent-to-agent tests
+	TargetAgentID int `json:"targetAgentId,omitempty"`
+}
+
+// TestGroup is a test label
+type TestGroup struct {
+	GroupID int    `json:"groupId"`
+	Name    string `json:"name"`
+}
+
+// TestResults are the test details fetched for one or more account groups
+type TestResults struct {
+	// Results are the decoded results per result family (TestHandler.Family)
+	Results map[string][]interface{}
+	// Counts of the tests before and after the TestFilter per account group
+	Counts []TestCount
+}
+
+// TestCount is the number of tests discovered in an account group and selected by the TestFilter
+type TestCount struct {
+	AccountGroup AccountGroup
+	Discovered   int
+	Selected     int
+	// Failed is the number of result requests of the selected tests that failed, their results are left out
+	Failed int
+}
+
+func (r *TestResults) append(o TestResults) {
+	for family, results := range o.Results {
+		r.add(family, results...)
+	}
+	r.Counts = append(r.Counts, o.Counts...)
+}
+
+func (r *TestResults) add(family string, results ...interface{}) {
+	if r.Results == nil {
+		r.Results = map[string][]interface{}{}
+	}
+	r.Results[family] = append(r.Results[family], results...)
+}
+
+// failed is the number of failed result requests of all account groups
+func (r TestResults) failed() int {
+	failed := 0
+	for _, c := range r.Counts {
+		failed += c.Failed
+	}
+	return failed
 }
 
 //https://api.thousandeyes.com/v6/net/bgp-metrics/557962.json
@@ -93,15 +161,21 @@ type ThousandTest struct {
 type BGPTestResults struct {
 	Net struct {
 		Test       ThousandTest `json:"test"`
-		BgpMetrics []struct {
-			CountryID    string  `json:"countryId"`
-			Prefix       string  `json:"prefix"`
-			MonitorName  string  `json:"monitorName"`
-			Reachability float32 `json:"reachability"`
-			Updates      float32 `json:"updates"`
-			PathChanges  float32 `json:"pathChanges"`
-		} `json:"bgpMetrics"`
+		BgpMetrics []BGPMetric  `json:"bgpMetrics"`
 	} `json:"net"`
+	Pages Pages `json:"pages"`
+	// AccountGroup the test belongs to
+	AccountGroup AccountGroup `json:"-"`
+}
+
+// BGPMetric of a prefix seen by a monitor
+type BGPMetric struct {
+	CountryID    string  `json:"countryId"`
+	Prefix       string  `json:"prefix"`
+	MonitorName  string  `json:"monitorName"`
+	Reachability float32 `json:"reachability"`
+	Updates      float32 `json:"updates"`
+	PathChanges  float32 `json:"pathChanges"`
 }
 
 // https://api.thousandeyes.com/v6/net/metrics/612434.json
@@ -110,41 +184,84 @@ type BGPTestResults struct {
 type HTTPTestMetricResults struct {
 	Net struct {
 		Test        ThousandTest `json:"test"`
-		HTTPMetrics []struct {
-			AvgLatency float32 `json:"avgLatency"`
-			Loss       float32 `json:"loss"`
-			MaxLatency float32 `json:"maxLatency"`
-			Jitter     float32 `json:"jitter"`
-			MinLatency float32 `json:"minLatency"`
-			ServerIP   string  `json:"serverIp"`
-			AgentName  string  `json:"agentName"`
-			CountryID  string  `json:"countryId"`
-		} `json:"metrics"`
+		HTTPMetrics []HTTPMetric `json:"metrics"`
 	} `json:"net"`
+	Pages Pages `json:"pages"`
+	// AccountGroup the test belongs to
+	AccountGroup AccountGroup `json:"-"`
+}
+
+// HTTPMetric network metrics of an agent
+type HTTPMetric struct {
+	AvgLatency float32 `json:"avgLatency"`
+	Loss       float32 `json:"loss"`
+	MaxLatency float32 `json:"maxLatency"`
+	Jitter     float32 `json:"jitter"`
+	MinLatency float32 `json:"minLatency"`
+	ServerIP   string  `json:"serverIp"`
+	AgentName  string  `json:"agentName"`
+	CountryID  string  `json:"countryId"`
 }
 
 // HTTPTestWebServerResults HTTP Test details on Server Response
 type HTTPTestWebServerResults struct {
 	Web struct {
-		Test       ThousandTest `json:"test"`
-		HTTPServer []struct {
-			ConnectTime  int    `json:"connectTime"`
-			DNSTime      int    `json:"dnsTime"`
-			ErrorType    string `json:"errorType"`
-			NumRedirects int    `json:"numRedirects"`
-			ReceiveTime  int    `json:"receiveTime"`
-			ResponseCode int    `json:"responseCode"`
-			ResponseTime int    `json:"responseTime"`
-			TotalTime    int    `json:"totalTime"`
-			WaitTime     int    `json:"waitTime"`
-			WireSize     int    `json:"wireSize"`
-			AgentName    string `json:"agentName"`
-			CountryID    string `json:"countryId"`
-			Date         string `json:"date"`
-			AgentID      int    `json:"agentId"`
-			RoundID      int    `json:"roundId"`
-		} `json:"httpServer"`
+		Test       ThousandTest       `json:"test"`
+		HTTPServer []HTTPServerResult `json:"httpServer"`
 	} `json:"web"`
+	Pages Pages `json:"pages"`
+	// AccountGroup the test belongs to
+	AccountGroup AccountGroup `json:"-"`
+}
+
+// HTTPServerResult server response seen by an agent
+type HTTPServerResult struct {
+	ConnectTime  int    `json:"connectTime"`
+	DNSTime      int    `json:"dnsTime"`
+	ErrorType    string `json:"errorType"`
+	NumRedirects int    `json:"numRedirects"`
+	ReceiveTime  int    `json:"receiveTime"`
+	ResponseCode int    `json:"responseCode"`
+	ResponseTime int    `json:"responseTime"`
+	TotalTime    int    `json:"totalTime"`
+	WaitTime     int    `json:"waitTime"`
+	WireSize     int    `json:"wireSize"`
+	AgentName    string `json:"agentName"`
+	CountryID    string `json:"countryId"`
+	Date         string `json:"date"`
+	AgentID      int    `json:"agentId"`
+	RoundID      int    `json:"roundId"`
+}
+
+// pagedResponse is implemented by the response objects of paginated endpoints, CallSingle walks all their pages
+type pagedResponse interface {
+	nextPage() string
+	appendPage(page interface{})
+}
+
+func (a *ThousandAlerts) nextPage() string { return a.Pages.Next }
+func (a *ThousandAlerts) appendPage(page interface{}) {
+	a.Alert = append(a.Alert, page.(*ThousandAlerts).Alert...)
+}
+
+func (t *ThousandTests) nextPage() string { return t.Pages.Next }
+func (t *ThousandTests) appendPage(page interface{}) {
+	t.Tests = append(t.Tests, page.(*ThousandTests).Tests...)
+}
+
+func (r *BGPTestResults) nextPage() string { return r.Pages.Next }
+func (r *BGPTestResults) appendPage(page interface{}) {
+	r.Net.BgpMetrics = append(r.Net.BgpMetrics, page.(*BGPTestResults).Net.BgpMetrics...)
+}
+
+func (r *HTTPTestMetricResults) nextPage() string { return r.Pages.Next }
+func (r *HTTPTestMetricResults) appendPage(page interface{}) {
+	r.Net.HTTPMetrics = append(r.Net.HTTPMetrics, page.(*HTTPTestMetricResults).Net.HTTPMetrics...)
+}
+
+func (r *HTTPTestWebServerResults) nextPage() string { return r.Pages.Next }
+func (r *HTTPTestWebServerResults) appendPage(page interface{}) {
+	r.Web.HTTPServer = append(r.Web.HTTPServer, page.(*HTTPTestWebServerResults).Web.HTTPServer...)
 }
 
 func thousandEyesDateTime() string {
@@ -155,84 +272,80 @@ func thousandEyesDateTime() string {
 	return string(f)
 }
 
-func (t *Collector) GetAlerts() (ThousandAlerts, bool, bool ) {
-
-	r := Request{
-		URL:            apiURLAlerts,
-		ResponseObject: new(ThousandAlerts),
-	}
-
-	bHitAPILimit, bError := CallSingle(t.Token, t.User, t.IsBasicAuth, &r)
+func (t *Collector) GetAlerts(ag AccountGroup) (ThousandAlerts, bool, bool ) {
 
-	return *r.ResponseObject.(*ThousandAlerts), bHitAPILimit, bError
+	alerts, bHitAPILimit, bError := t.newBackend().getAlerts(t, ag)
+	alerts.AccountGroup = ag
+	alerts.Timezone = t.timezone()
+	return alerts, bHitAPILimit, bError
 }
 
-func (t *Collector) GetTests() (bgpMs []BGPTestResults, httpMs []HTTPTestMetricResults, httpWs []HTTPTestWebServerResults, bHitAPILimit, bError bool) {
+// GetTests fetches the results of the selected tests of the account group, bError is set only if the tests could not be listed,
+// the failed result requests are counted in TestCount.Failed
+func (t *Collector) GetTests(ag AccountGroup) (results TestResults, bHitAPILimit, bError bool) {
 
-	rTests := Request{
-		URL:            apiURLTests,
-		ResponseObject: new(ThousandTests),
-	}
-	bHitAPILimit, bError = CallSingle(t.Token, t.User, t.IsBasicAuth, &rTests)
-	if rTests.Error != nil {
-		return bgpMs, httpMs, httpWs, bHitAPILimit, bError
+	b := t.newBackend()
+	tests, bHitAPILimit, bError := b.getTests(t, ag)
+	if bError {
+		return results, bHitAPILimit, bError
 	}
 
-	te := rTests.ResponseObject.(*ThousandTests)
+	selected := t.TestFilter.Select(tests)
+	results.Counts = []TestCount{{AccountGroup: ag, Discovered: len(tests), Selected: len(selected)}}
 
+	ctx := t.newTestContext(b, ag)
 	var testRequests []Request
+	var testHandlers []TestHandler
 
-	log.Println(fmt.Sprintf("INFO: ThousandEyes Test Count: %d", len(te.Tests)))
-
-	for i := range te.Tests {
-		switch te.Tests[i].Type {
-		case "http-server":
+	log.Println(fmt.Sprintf("INFO: ThousandEyes Test Count: %d, selected: %d (account group: %s)", len(tests), len(selected), ag.Name))
 
-			if t.IsCollectHttp {
-				testRequests = append(testRequests, Request{
-					URL:            fmt.Sprintf(apiURLTestHTTP, te.Tests[i].TestID),
-					ResponseObject: new(HTTPTestWebServerResults),
-				})
+	for i := range selected {
+		if !t.isTestTypeHandled(selected[i].Type) {
+			log.Println(fmt.Sprintf("ERROR: Not a handled test type: %s. Bug. Fix Code.", selected[i].Type))
+			continue
+		}
+		for _, h := range t.TestHandlers {
+			if !handles(h, selected[i].Type) {
+				continue
 			}
-			if t.IsCollectHttpMetrics {
-				testRequests = append(testRequests, Request{
-					URL:            fmt.Sprintf(apiURLTestHTTPMetrics, te.Tests[i].TestID),
-					ResponseObject: new(HTTPTestMetricResults),
-				})
+			r, ok := h.Request(ctx, selected[i])
+			if !ok {
+				log.Println(fmt.Sprintf("INFO: Result family %s is not available in ThousandEyes API %s (test %d).", h.Family(), ctx.APIVersion, selected[i].TestID))
+				continue
 			}
+			r.URL = withAccountGroup(r.URL, ag)
+			testRequests = append(testRequests, r)
+			testHandlers = append(testHandlers, h)
+		}
+	}
 
-		case "bgp":
-
-			if t.IsCollectBgp {
-				testRequests = append(testRequests, Request{
-					URL:            fmt.Sprintf(apiURLTestBGB, te.Tests[i].TestID),
-					ResponseObject: new(BGPTestResults),
-				})
-			}
+	// a failed result request fails its test only, not the refresh: the error is logged and counted
+	// (thousandeyes_api_failures_total) by CallSingle already, e.g. a 404 of a test deleted since it was listed
+	//CallSequence(t.token, testRequests)
+	bHitAPILimit, _ = CallParallel(t.Token, t.User, t.IsBasicAuth, t.MaxParallelRequests, t.MaxPages, t.retries, testRequests)
 
-		default:
-			log.Println(fmt.Sprintf("ERROR: Not a handled test type: %s. Bug. Fix Code.", te.Tests[i].Type))
+	for c := range testRequests {
+		if testRequests[c].Error != nil {
+			results.Counts[0].Failed++
 		}
 	}
+	if results.Counts[0].Failed > 0 {
+		log.Println(fmt.Sprintf("ERROR: %d of %d ThousandEyes test result requests failed, their results are left out (account group: %s)", results.Counts[0].Failed, len(testRequests), ag.Name))
+	}
 
-	//CallSequence(t.token, testRequests)
-	bHitAPILimit, bError = CallParallel(t.Token, t.User, t.IsBasicAuth, testRequests)
-
-	for c, o := range testRequests {
-
-		//switch v:=o.ResponseObject.(type) {
-		//v := reflect.TypeOf(o.ResponseObject)
-		switch o.ResponseObject.(type) {
-			case *BGPTestResults:
-				bgpMs = append(bgpMs,*testRequests[c].ResponseObject.(*BGPTestResults))
-			case *HTTPTestMetricResults:
-				httpMs = append(httpMs,*testRequests[c].ResponseObject.(*HTTPTestMetricResults))
-			case *HTTPTestWebServerResults:
-				httpWs = append(httpWs,*testRequests[c].ResponseObject.(*HTTPTestWebServerResults))
-			default:
-				log.Println(fmt.Sprintf("ERROR: Not a handled test type %s (%d of %d). Bug. Fix Code.", reflect.TypeOf(o.ResponseObject), c, len(testRequests)))
+	for c := range testRequests {
+		// the response object of a failed request is empty, it is not a result
+		if testRequests[c].Error != nil {
+			continue
+		}
+
+		o := testHandlers[c].Decode(ctx, testRequests[c])
+		if o == nil {
+			log.Println(fmt.Sprintf("ERROR: Not a handled result %s of family %s (%d of %d). Bug. Fix Code.", reflect.TypeOf(testRequests[c].ResponseObject), testHandlers[c].Family(), c, len(testRequests)))
+			continue
 		}
+		results.add(testHandlers[c].Family(), o)
 	}
 
-	return bgpMs, httpMs, httpWs, bHitAPILimit, bError
+	return results, bHitAPILimit, false
 }
@@ -0,0 +1,52 @@
+package thousandeyes
+
+import "testing"
+
+func TestGetTestsSkipsFailedRequests(t *testing.T) {
+	tests := []struct {
+		version string
+		bodies  map[string]string
+	}{
+		{
+			APIVersion6,
+			map[string]string{
+				"/v6/tests.json":             `{"test": [{"testId": 1, "type": "http-server"}, {"testId": 2, "type": "http-server"}]}`,
+				"/v6/web/http-server/1.json": `{"web": {"test": {"testId": 1}, "httpServer": [{"agentName": "Frankfurt"}]}}`,
+			},
+		},
+		{
+			APIVersion7,
+			map[string]string{
+				"/v7/tests":                      `{"tests": [{"testId": "1", "type": "http-server"}, {"testId": "2", "type": "http-server"}]}`,
+				"/v7/agents":                     `{"agents": [{"agentId": "5", "agentName": "Frankfurt"}]}`,
+				"/v7/test-results/1/http-server": `{"test": {"testId": "1"}, "results": [{"agentId": "5"}]}`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			redirectAPI(t, newTestAPI(t, tt.bodies))
+
+			c := &Collector{Token: "token", APIVersion: tt.version}
+			c.TestHandlers = []TestHandler{newHTTPHandler()}
+			results, _, bError := c.GetTests(AccountGroup{})
+			if bError {
+				t.Fatalf("error, only the results of test 2 failed")
+			}
+			if failed := results.failed(); failed != 1 {
+				t.Errorf("failed %d, want 1", failed)
+			}
+
+			// the empty response of test 2 is not decoded
+			http := results.Results[FamilyHTTP]
+			if len(http) != 1 {
+				t.Fatalf("%d results, want 1", len(http))
+			}
+			r := http[0].(HTTPTestWebServerResults)
+			if r.Web.Test.TestID != 1 || len(r.Web.HTTPServer) != 1 || r.Web.HTTPServer[0].AgentName != "Frankfurt" {
+				t.Errorf("result %+v, want the one of test 1 by Frankfurt", r.Web)
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package thousandeyes
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"log"
+)
+
+const (
+	apiURLTestPageLoad   = "https://api.thousandeyes.com/v6/web/page-load/%d.json"
+	apiURLv7TestPageLoad = "https://api.thousandeyes.com/v7/test-results/%d/page-load"
+)
+
+var (
+	// - page load tests
+	ThousandTestPageLoadDOMLoadTimeDesc = prometheus.NewDesc(
+		"thousandeyes_test_page_load_dom_load_time_milliseconds",
+		"Page load test ran in ThousandEyes - metric: domLoadTime.",
+		agentTestLabels,
+		nil)
+	ThousandTestPageLoadPageLoadTimeDesc = prometheus.NewDesc(
+		"thousandeyes_test_page_load_page_load_time_milliseconds",
+		"Page load test ran in ThousandEyes - metric: pageLoadTime.",
+		agentTestLabels,
+		nil)
+	ThousandTestPageLoadResponseTimeDesc = prometheus.NewDesc(
+		"thousandeyes_test_page_load_response_time_milliseconds",
+		"Page load test ran in ThousandEyes - metric: responseTime.",
+		agentTestLabels,
+		nil)
+	ThousandTestPageLoadErrorDesc = prometheus.NewDesc(
+		"thousandeyes_test_page_load_error",
+		"Page load test ran in ThousandEyes - 1 if the agent saw an error, its type is the label error_type.",
+		append(append([]string{}, agentTestLabels...), "error_type"),
+		nil)
+)
+
+//https://api.thousandeyes.com/v6/web/page-load/612434.json
+
+// PageLoadTestResults page load test details
+type PageLoadTestResults struct {
+	Web struct {
+		Test     ThousandTest     `json:"test"`
+		PageLoad []PageLoadResult `json:"pageLoad"`
+	} `json:"web"`
+	Pages Pages `json:"pages"`
+	// AccountGroup the test belongs to
+	AccountGroup AccountGroup `json:"-"`
+}
+
+// PageLoadResult page load seen by an agent
+type PageLoadResult struct {
+	DOMLoadTime  int    `json:"domLoadTime"`
+	PageLoadTime int    `json:"pageLoadTime"`
+	ResponseTime int    `json:"responseTime"`
+	NumObjects   int    `json:"numObjects"`
+	NumErrors    int    `json:"numErrors"`
+	ErrorType    string `json:"errorType"`
+	AgentName    string `json:"agentName"`
+	CountryID    string `json:"countryId"`
+	Date         string `json:"date"`
+	AgentID      int    `json:"agentId"`
+	RoundID      int    `json:"roundId"`
+}
+
+func (r *PageLoadTestResults) nextPage() string { return r.Pages.Next }
+func (r *PageLoadTestResults) appendPage(page interface{}) {
+	r.Web.PageLoad = append(r.Web.PageLoad, page.(*PageLoadTestResults).Web.PageLoad...)
+}
+
+type v7PageLoadResults struct {
+	Test    v7Test `json:"test"`
+	Results []struct {
+		PageLoadResult
+		AgentID string `json:"agentId"`
+	} `json:"results"`
+	Links v7Links `json:"_links"`
+}
+
+func (r *v7PageLoadResults) nextPage() string { return r.Links.Next.Href }
+func (r *v7PageLoadResults) appendPage(page interface{}) {
+	r.Results = append(r.Results, page.(*v7PageLoadResults).Results...)
+}
+
+func (r *v7PageLoadResults) result(ctx *TestContext) interface{} {
+	res := new(PageLoadTestResults)
+	res.Web.Test = r.Test.toV6()
+	for _, m := range r.Results {
+		pageLoad := m.PageLoadResult
+		pageLoad.AgentID = v7ID(m.AgentID)
+		agent := ctx.v7Agent(m.AgentID)
+		pageLoad.AgentName = agent.AgentName
+		pageLoad.CountryID = agent.CountryID
+		res.Web.PageLoad = append(res.Web.PageLoad, pageLoad)
+	}
+	return res
+}
+
+// newPageLoadHandler collects the page load results of page-load tests
+func newPageLoadHandler() TestHandler {
+	return resultHandler{
+		handlerInfo: handlerInfo{
+			family:    FamilyPageLoad,
+			testTypes: []string{"page-load"},
+			descs: []*prometheus.Desc{
+				ThousandTestPageLoadDOMLoadTimeDesc,
+				ThousandTestPageLoadPageLoadTimeDesc,
+				ThousandTestPageLoadResponseTimeDesc,
+				ThousandTestPageLoadErrorDesc,
+			},
+		},
+		requests: resultRequests{
+			APIVersion6: {apiURLTestPageLoad, func() interface{} { return new(PageLoadTestResults) }},
+			APIVersion7: {apiURLv7TestPageLoad, func() interface{} { return new(v7PageLoadResults) }},
+		},
+		collect: collectPageLoad,
+	}
+}
+
+func collectPageLoad(tPageLoad []PageLoadTestResults, ch chan<- prometheus.Metric) {
+
+	for e := range tPageLoad {
+		if len(tPageLoad[e].Web.PageLoad) == 0 {
+			log.Println("INFO: Page load metrics are empty for Test:", tPageLoad[e])
+			continue
+		}
+		for _, p := range tPageLoad[e].Web.PageLoad {
+
+			labels := agentTestLabelValues(tPageLoad[e].Web.Test, p.CountryID, p.AgentName, tPageLoad[e].AccountGroup)
+
+			ch <- prometheus.MustNewConstMetric(
+				ThousandTestPageLoadDOMLoadTimeDesc,
+				prometheus.GaugeValue,
+				float64(p.DOMLoadTime),
+				labels...,
+			)
+			ch <- prometheus.MustNewConstMetric(
+				ThousandTestPageLoadPageLoadTimeDesc,
+				prometheus.GaugeValue,
+				float64(p.PageLoadTime),
+				labels...,
+			)
+			ch <- prometheus.MustNewConstMetric(
+				ThousandTestPageLoadResponseTimeDesc,
+				prometheus.GaugeValue,
+				float64(p.ResponseTime),
+				labels...,
+			)
+
+			isError := 0.0
+			if isErrorType(p.ErrorType) {
+				isError = 1
+			}
+			ch <- prometheus.MustNewConstMetric(
+				ThousandTestPageLoadErrorDesc,
+				prometheus.GaugeValue,
+				isError,
+				append(labels, p.ErrorType)...,
+			)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package thousandeyes
+
+import (
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"log"
+	"strings"
+)
+
+const (
+	apiURLTestPathVis   = "https://api.thousandeyes.com/v6/net/path-vis/%d.json"
+	apiURLv7TestPathVis = "https://api.thousandeyes.com/v7/test-results/%d/path-vis"
+)
+
+// pathVisTestLabels are the labels of the path visualization summaries, one per agent and server ip
+var pathVisTestLabels = []string{"test_id", "test_name", "type", "country", "agent_name", "server_ip", "account_group_id", "account_group_name"}
+
+var (
+	// - path visualization of network tests, summaries only - full traces do not belong into Prometheus
+	ThousandTestPathVisHopsDesc = prometheus.NewDesc(
+		"thousandeyes_test_path_vis_hops",
+		"Path visualization of a network test ran in ThousandEyes - number of hops of the longest path seen.",
+		pathVisTestLabels,
+		nil)
+	ThousandTestPathVisPathsDesc = prometheus.NewDesc(
+		"thousandeyes_test_path_vis_distinct_paths",
+		"Path visualization of a network test ran in ThousandEyes - number of distinct paths (hop ip addresses) seen in the round.",
+		pathVisTestLabels,
+		nil)
+	ThousandTestPathVisMaxHopDelayDesc = prometheus.NewDesc(
+		"thousandeyes_test_path_vis_max_hop_delay_milliseconds",
+		"Path visualization of a network test ran in ThousandEyes - highest delay of a single hop.",
+		pathVisTestLabels,
+		nil)
+	ThousandTestPathVisLossHopsDesc = prometheus.NewDesc(
+		"thousandeyes_test_path_vis_hops_with_loss",
+		"Path visualization of a network test ran in ThousandEyes - number of distinct hops with packet loss.",
+		pathVisTestLabels,
+		nil)
+)
+
+//https://api.thousandeyes.com/v6/net/path-vis/612434.json
+
+// PathVisTestResults path visualization details of a network test
+type PathVisTestResults struct {
+	Net struct {
+		Test    ThousandTest    `json:"test"`
+		PathVis []PathVisResult `json:"pathVis"`
+	} `json:"net"`
+	Pages Pages `json:"pages"`
+	// AccountGroup the test belongs to
+	AccountGroup AccountGroup `json:"-"`
+}
+
+// PathVisResult are the paths from an agent to a server ip
+type PathVisResult struct {
+	ServerIP  string         `json:"serverIp"`
+	Routes    []PathVisRoute `json:"routes"`
+	AgentName string         `json:"agentName"`
+	CountryID string         `json:"countryId"`
+	AgentID   int            `json:"agentId"`
+	RoundID   int            `json:"roundId"`
+}
+
+// PathVisRoute is one path traced
+type PathVisRoute struct {
+	Hops []PathVisHop `json:"hops"`
+}
+
+// PathVisHop is a hop of a path, Loss is the packet loss at the hop
+type PathVisHop struct {
+	Hop       int     `json:"hop"`
+	IPAddress string  `json:"ipAddress"`
+	Delay     float32 `json:"delay"`
+	Loss      float32 `json:"loss"`
+}
+
+func (r *PathVisTestResults) nextPage() string { return r.Pages.Next }
+func (r *PathVisTestResults) appendPage(page interface{}) {
+	r.Net.PathVis = append(r.Net.PathVis, page.(*PathVisTestResults).Net.PathVis...)
+}
+
+// v7 calls the routes path traces
+type v7PathVisResults struct {
+	Test    v7Test `json:"test"`
+	Results []struct {
+		PathVisResult
+		PathTraces []PathVisRoute `json:"pathTraces"`
+		AgentID    string         `json:"agentId"`
+	} `json:"results"`
+	Links v7Links `json:"_links"`
+}
+
+func (r *v7PathVisResults) nextPage() string { return r.Links.Next.Href }
+func (r *v7PathVisResults) appendPage(page interface{}) {
+	r.Results = append(r.Results, page.(*v7PathVisResults).Results...)
+}
+
+func (r *v7PathVisResults) result(ctx *TestContext) interface{} {
+	res := new(PathVisTestResults)
+	res.Net.Test = r.Test.toV6()
+	for _, m := range r.Results {
+		pathVis := m.PathVisResult
+		pathVis.Routes = m.PathTraces
+		pathVis.AgentID = v7ID(m.AgentID)
+		agent := ctx.v7Agent(m.AgentID)
+		pathVis.AgentName = agent.AgentName
+		pathVis.CountryID = agent.CountryID
+		res.Net.PathVis = append(res.Net.PathVis, pathVis)
+	}
+	return res
+}
+
+// pathVisSummary of all paths from an agent to a server ip
+type pathVisSummary struct {
+	agentName   string
+	countryID   string
+	serverIP    string
+	hops        int
+	paths       map[string]bool
+	maxHopDelay float32
+	lossHops    map[string]bool
+}
+
+// summarizePathVis sums the paths up per agent and server ip, in the order they were returned
+func summarizePathVis(results []PathVisResult) []*pathVisSummary {
+	var summaries []*pathVisSummary
+	byKey := map[string]*pathVisSummary{}
+
+	for _, r := range results {
+		key := r.AgentName + "/" + r.ServerIP
+		s, ok := byKey[key]
+		if !ok {
+			s = &pathVisSummary{
+				agentName: r.AgentName,
+				countryID: r.CountryID,
+				serverIP:  r.ServerIP,
+				paths:     map[string]bool{},
+				lossHops:  map[string]bool{},
+			}
+			byKey[key] = s
+			summaries = append(summaries, s)
+		}
+
+		for _, route := range r.Routes {
+			if len(route.Hops) > s.hops {
+				s.hops = len(route.Hops)
+			}
+			var path []string
+			for _, hop := range route.Hops {
+				path = append(path, hop.IPAddress)
+				if hop.Delay > s.maxHopDelay {
+					s.maxHopDelay = hop.Delay
+				}
+				if hop.Loss > 0 {
+					s.lossHops[fmt.Sprintf("%d/%s", hop.Hop, hop.IPAddress)] = true
+				}
+			}
+			s.paths[strings.Join(path, ",")] = true
+		}
+	}
+	return summaries
+}
+
+// newPathVisHandler adds path visualization summaries to the network tests
+func newPathVisHandler() TestHandler {
+	return resultHandler{
+		handlerInfo: handlerInfo{
+			family:    FamilyPathVis,
+			testTypes: []string{"http-server", "agent-to-server", "agent-to-agent"},
+			descs: []*prometheus.Desc{
+				ThousandTestPathVisHopsDesc,
+				ThousandTestPathVisPathsDesc,
+				ThousandTestPathVisMaxHopDelayDesc,
+				ThousandTestPathVisLossHopsDesc,
+			},
+		},
+		requests: resultRequests{
+			APIVersion6: {apiURLTestPathVis, func() interface{} { return new(PathVisTestResults) }},
+			APIVersion7: {apiURLv7TestPathVis, func() interface{} { return new(v7PathVisResults) }},
+		},
+		collect: collectPathVis,
+	}
+}
+
+func collectPathVis(tPathVis []PathVisTestResults, ch chan<- prometheus.Metric) {
+
+	for e := range tPathVis {
+		if len(tPathVis[e].Net.PathVis) == 0 {
+			log.Println("INFO: Path visualization metrics are empty for Test:", tPathVis[e])
+			continue
+		}
+		test := tPathVis[e].Net.Test
+		ag := tPathVis[e].AccountGroup
+
+		for _, s := range summarizePathVis(tPathVis[e].Net.PathVis) {
+
+			labels := []string{
+				fmt.Sprintf("%d", test.TestID),
+				test.TestName,
+				test.Type,
+				s.countryID,
+				s.agentName,
+				s.serverIP,
+				fmt.Sprintf("%d", ag.AID),
+				ag.Name,
+			}
+
+			ch <- prometheus.MustNewConstMetric(
+				ThousandTestPathVisHopsDesc,
+				prometheus.GaugeValue,
+				float64(s.hops),
+				labels...,
+			)
+			ch <- prometheus.MustNewConstMetric(
+				ThousandTestPathVisPathsDesc,
+				prometheus.GaugeValue,
+				float64(len(s.paths)),
+				labels...,
+			)
+			ch <- prometheus.MustNewConstMetric(
+				ThousandTestPathVisMaxHopDelayDesc,
+				prometheus.GaugeValue,
+				float64(s.maxHopDelay),
+				labels...,
+			)
+			ch <- prometheus.MustNewConstMetric(
+				ThousandTestPathVisLossHopsDesc,
+				prometheus.GaugeValue,
+				float64(len(s.lossHops)),
+				labels...,
+			)
+		}
+	}
+}
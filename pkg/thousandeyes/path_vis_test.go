@@ -0,0 +1,87 @@
+package thousandeyes
+
+import "testing"
+
+func TestSummarizePathVis(t *testing.T) {
+	route := func(hops ...PathVisHop) PathVisRoute { return PathVisRoute{Hops: hops} }
+	hop := func(n int, ip string, delay float32, loss float32) PathVisHop {
+		return PathVisHop{Hop: n, IPAddress: ip, Delay: delay, Loss: loss}
+	}
+
+	type summary struct {
+		agentName   string
+		serverIP    string
+		hops        int
+		paths       int
+		maxHopDelay float32
+		lossHops    int
+	}
+
+	tests := []struct {
+		name    string
+		results []PathVisResult
+		want    []summary
+	}{
+		{"no results", nil, nil},
+		{
+			"one path",
+			[]PathVisResult{{AgentName: "Frankfurt", ServerIP: "1.1.1.1", Routes: []PathVisRoute{
+				route(hop(1, "10.0.0.1", 1, 0), hop(2, "1.1.1.1", 5, 0)),
+			}}},
+			[]summary{{"Frankfurt", "1.1.1.1", 2, 1, 5, 0}},
+		},
+		{
+			"the same path traced twice",
+			[]PathVisResult{{AgentName: "Frankfurt", ServerIP: "1.1.1.1", Routes: []PathVisRoute{
+				route(hop(1, "10.0.0.1", 1, 0), hop(2, "1.1.1.1", 5, 0)),
+				route(hop(1, "10.0.0.1", 2, 0), hop(2, "1.1.1.1", 4, 0)),
+			}}},
+			[]summary{{"Frankfurt", "1.1.1.1", 2, 1, 5, 0}},
+		},
+		{
+			"load balanced paths of different length",
+			[]PathVisResult{{AgentName: "Frankfurt", ServerIP: "1.1.1.1", Routes: []PathVisRoute{
+				route(hop(1, "10.0.0.1", 1, 0), hop(2, "1.1.1.1", 5, 0)),
+				route(hop(1, "10.0.0.2", 1, 0), hop(2, "10.1.0.1", 9, 0), hop(3, "1.1.1.1", 7, 0)),
+			}}},
+			[]summary{{"Frankfurt", "1.1.1.1", 3, 2, 9, 0}},
+		},
+		{
+			"hops with loss are counted once",
+			[]PathVisResult{{AgentName: "Frankfurt", ServerIP: "1.1.1.1", Routes: []PathVisRoute{
+				route(hop(1, "10.0.0.1", 1, 10), hop(2, "1.1.1.1", 5, 50)),
+				route(hop(1, "10.0.0.1", 1, 20), hop(2, "1.1.1.1", 5, 0)),
+			}}},
+			[]summary{{"Frankfurt", "1.1.1.1", 2, 1, 5, 2}},
+		},
+		{
+			"rounds of the same agent and server are merged, in the order returned",
+			[]PathVisResult{
+				{AgentName: "Tokyo", ServerIP: "1.1.1.1", Routes: []PathVisRoute{route(hop(1, "10.2.0.1", 3, 0))}},
+				{AgentName: "Frankfurt", ServerIP: "1.1.1.1", Routes: []PathVisRoute{route(hop(1, "10.0.0.1", 1, 0))}},
+				{AgentName: "Tokyo", ServerIP: "2.2.2.2", Routes: []PathVisRoute{route(hop(1, "10.2.0.1", 2, 0))}},
+				{AgentName: "Tokyo", ServerIP: "1.1.1.1", Routes: []PathVisRoute{route(hop(1, "10.2.0.2", 6, 0), hop(2, "1.1.1.1", 4, 0))}},
+			},
+			[]summary{
+				{"Tokyo", "1.1.1.1", 2, 2, 6, 0},
+				{"Frankfurt", "1.1.1.1", 1, 1, 1, 0},
+				{"Tokyo", "2.2.2.2", 1, 1, 2, 0},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := summarizePathVis(tt.results)
+			if len(got) != len(tt.want) {
+				t.Fatalf("%d summaries, want %d", len(got), len(tt.want))
+			}
+			for i, s := range got {
+				g := summary{s.agentName, s.serverIP, s.hops, len(s.paths), s.maxHopDelay, len(s.lossHops)}
+				if g != tt.want[i] {
+					t.Errorf("summary %d %+v, want %+v", i, g, tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,274 @@
+package thousandeyes
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"log"
+	"time"
+)
+
+const (
+	familyAlerts     = "alerts"
+	familyTests      = "tests"
+	familyAgents     = "agents"
+	familyEndpoint   = "endpoint"
+	familyAlertRules = "alert-rules"
+
+	defaultPollInterval = 60 * time.Second
+	// the account groups rarely change, they are not fetched on every refresh
+	defaultAccountGroupsPollInterval = time.Hour
+)
+
+// snapshot is the last good state fetched from the ThousandEyes API
+// a failed refresh keeps the former data of that family
+type snapshot struct {
+	alerts        []ThousandAlerts
+	alertsUpdated time.Time
+
+	tests        TestResults
+	testsUpdated time.Time
+
+	agents        []ThousandAgents
+	agentsUpdated time.Time
+
+	endpoint        []EndpointData
+	endpointUpdated time.Time
+
+	alertRules        []ThousandAlertRules
+	alertRulesUpdated time.Time
+}
+
+// Run refreshes the snapshot right away and afterwards alerts every PollInterval and tests every TestsPollInterval
+// until stop is closed - start it in its own go routine, done is closed when it returns
+func (t *Collector) Run(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+
+	var nextAlerts, nextTests time.Time
+	for {
+		now := time.Now()
+		bAlerts := !now.Before(nextAlerts)
+		bTests := t.isCollectTests() && !now.Before(nextTests)
+
+		t.refresh(bAlerts, bTests)
+		if bAlerts {
+			nextAlerts = now.Add(t.pollInterval())
+		}
+		if bTests {
+			nextTests = now.Add(t.testsPollInterval())
+		}
+
+		next := nextAlerts
+		if t.isCollectTests() && nextTests.Before(next) {
+			next = nextTests
+		}
+		select {
+		case <-stop:
+			return
+		case <-time.After(time.Until(next)):
+		}
+	}
+}
+
+// Refresh fetches alerts and (if any test family is enabled) test results from the API and
+// swaps them into the snapshot served by Collect
+func (t *Collector) Refresh() {
+	t.refresh(true, t.isCollectTests())
+}
+
+func (t *Collector) refresh(bAlerts bool, bTests bool) {
+	refreshStart := time.Now()
+	defer func() {
+		ThousandRequestScrapingTime.Set(time.Since(refreshStart).Seconds())
+	}()
+
+	defer func() {
+		if r := recover(); r != nil {
+			ThousandRequestParsingFailMetric.Inc()
+			log.Println("ERROR: Thousand Eyes Parsing Error (", r, ").")
+		}
+	}()
+
+	t.retries = NewRetryBudget()
+
+	groups, _, bError := t.cachedAccountGroups(t)
+	if bError {
+		if bAlerts {
+			t.setRefreshResult(familyAlerts, bError)
+		}
+		if bTests {
+			t.setRefreshResult(familyTests, bError)
+		}
+		if bAlerts && t.IsCollectAgents {
+			t.setRefreshResult(familyAgents, bError)
+		}
+		if bAlerts && t.IsCollectEndpointAgents {
+			t.setRefreshResult(familyEndpoint, bError)
+		}
+		if bAlerts && t.IsCollectAlertRules {
+			t.setRefreshResult(familyAlertRules, bError)
+		}
+		return
+	}
+
+	if bAlerts {
+		var alerts []ThousandAlerts
+		bErrorAlerts := false
+		for _, ag := range groups {
+			a, _, bError := t.GetAlerts(ag)
+			bErrorAlerts = bErrorAlerts || bError
+			alerts = append(alerts, a)
+		}
+		t.setRefreshResult(familyAlerts, bErrorAlerts)
+		if !bErrorAlerts {
+			t.mu.Lock()
+			t.snapshot.alerts = alerts
+			t.snapshot.alertsUpdated = time.Now()
+			t.mu.Unlock()
+		}
+	}
+
+	// the agent inventory is refreshed with the alerts
+	if bAlerts && t.IsCollectAgents {
+		var agents []ThousandAgents
+		bErrorAgents := false
+		for _, ag := range groups {
+			a, _, bError := t.GetAgents(ag)
+			bErrorAgents = bErrorAgents || bError
+			agents = append(agents, a)
+		}
+		t.setRefreshResult(familyAgents, bErrorAgents)
+		if !bErrorAgents {
+			t.mu.Lock()
+			t.snapshot.agents = agents
+			t.snapshot.agentsUpdated = time.Now()
+			t.mu.Unlock()
+		}
+	}
+
+	// the endpoint agents and their scheduled test results are refreshed with the alerts as well
+	if bAlerts && t.IsCollectEndpointAgents {
+		var endpoint []EndpointData
+		bErrorEndpoint := false
+		for _, ag := range groups {
+			d, _, bError := t.GetEndpointData(ag)
+			bErrorEndpoint = bErrorEndpoint || bError
+			endpoint = append(endpoint, d)
+		}
+		t.setRefreshResult(familyEndpoint, bErrorEndpoint)
+		if !bErrorEndpoint {
+			t.mu.Lock()
+			t.snapshot.endpoint = endpoint
+			t.snapshot.endpointUpdated = time.Now()
+			t.mu.Unlock()
+		}
+	}
+
+	// the alert rules are refreshed with the alerts they belong to
+	if bAlerts && t.IsCollectAlertRules {
+		var alertRules []ThousandAlertRules
+		bErrorAlertRules := false
+		for _, ag := range groups {
+			r, _, bError := t.GetAlertRules(ag)
+			bErrorAlertRules = bErrorAlertRules || bError
+			alertRules = append(alertRules, r)
+		}
+		t.setRefreshResult(familyAlertRules, bErrorAlertRules)
+		if !bErrorAlertRules {
+			t.mu.Lock()
+			t.snapshot.alertRules = alertRules
+			t.snapshot.alertRulesUpdated = time.Now()
+			t.mu.Unlock()
+		}
+	}
+
+	if bTests {
+
+		var tests TestResults
+		bErrorTests := false
+
+		for _, ag := range groups {
+			r, _, bError := t.GetTests(ag)
+			bErrorTests = bErrorTests || bError
+			tests.append(r)
+		}
+
+		t.setRefreshResult(familyTests, bErrorTests)
+		if !bErrorTests {
+			t.mu.Lock()
+			t.snapshot.tests = tests
+			t.snapshot.testsUpdated = time.Now()
+			t.mu.Unlock()
+		}
+	}
+}
+
+func (t *Collector) setRefreshResult(family string, bError bool) {
+	if bError {
+		ThousandRequestsFailMetric.Inc()
+		ThousandLastRefreshSuccess.WithLabelValues(family).Set(0)
+		log.Printf("ERROR: Refresh of %s failed, serving the last good snapshot.", family)
+		return
+	}
+	ThousandLastRefreshSuccess.WithLabelValues(family).Set(1)
+}
+
+func (t *Collector) isCollectTests() bool {
+	return len(t.TestHandlers) > 0
+}
+
+func (t *Collector) getSnapshot() snapshot {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.snapshot
+}
+
+// InheritSnapshot takes over the snapshot of the collector replaced on a config reload,
+// so the metrics are served without a gap until the first refresh is done
+func (t *Collector) InheritSnapshot(old *Collector) {
+	s := old.getSnapshot()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.snapshot = s
+}
+
+func (t *Collector) pollInterval() time.Duration {
+	if t.PollInterval <= 0 {
+		return defaultPollInterval
+	}
+	return t.PollInterval
+}
+
+func (t *Collector) accountGroupsPollInterval() time.Duration {
+	if t.AccountGroupsPollInterval <= 0 {
+		return defaultAccountGroupsPollInterval
+	}
+	return t.AccountGroupsPollInterval
+}
+
+func (t *Collector) testsPollInterval() time.Duration {
+	if t.TestsPollInterval <= 0 {
+		return t.pollInterval()
+	}
+	return t.TestsPollInterval
+}
+
+// collectSnapshotAge reports the age per family, families never refreshed successfully are left out
+func collectSnapshotAge(s snapshot, ch chan<- prometheus.Metric) {
+	updated := map[string]time.Time{
+		familyAlerts:     s.alertsUpdated,
+		familyTests:      s.testsUpdated,
+		familyAgents:     s.agentsUpdated,
+		familyEndpoint:   s.endpointUpdated,
+		familyAlertRules: s.alertRulesUpdated,
+	}
+	for family, u := range updated {
+		if u.IsZero() {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(
+			ThousandSnapshotAgeDesc,
+			prometheus.GaugeValue,
+			time.Since(u).Seconds(),
+			family,
+		)
+	}
+}
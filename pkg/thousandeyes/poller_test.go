@@ -0,0 +1,62 @@
+package thousandeyes
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRefreshTestsWithFailedResults(t *testing.T) {
+	const accountGroups = `{"accountGroups": [{"aid": 0, "accountGroupName": "ops", "default": 1}]}`
+	const testList = `{"test": [{"testId": 1, "type": "http-server"}, {"testId": 2, "type": "http-server"}]}`
+
+	tests := []struct {
+		name        string
+		bodies      map[string]string
+		wantSuccess float64
+		wantUpdated bool
+		wantFailed  int
+	}{
+		{
+			"a failed test does not fail the refresh",
+			map[string]string{
+				"/v6/account-groups.json":    accountGroups,
+				"/v6/tests.json":             testList,
+				"/v6/web/http-server/1.json": `{"web": {"test": {"testId": 1}, "httpServer": [{"agentName": "Frankfurt"}]}}`,
+			},
+			1,
+			true,
+			1,
+		},
+		{
+			"the test list failed",
+			map[string]string{
+				"/v6/account-groups.json": accountGroups,
+			},
+			0,
+			false,
+			0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			redirectAPI(t, newTestAPI(t, tt.bodies))
+
+			c := &Collector{Token: "token"}
+			c.TestHandlers = []TestHandler{newHTTPHandler()}
+			c.refresh(false, true)
+
+			if got := testutil.ToFloat64(ThousandLastRefreshSuccess.WithLabelValues(familyTests)); got != tt.wantSuccess {
+				t.Errorf("last refresh success %v, want %v", got, tt.wantSuccess)
+			}
+			s := c.getSnapshot()
+			if updated := !s.testsUpdated.IsZero(); updated != tt.wantUpdated {
+				t.Fatalf("snapshot replaced %t, want %t", updated, tt.wantUpdated)
+			}
+			if tt.wantUpdated && s.tests.failed() != tt.wantFailed {
+				t.Errorf("failed %d, want %d", s.tests.failed(), tt.wantFailed)
+			}
+		})
+	}
+}
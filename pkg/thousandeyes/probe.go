@@ -0,0 +1,144 @@
+package thousandeyes
+
+import (
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ThousandProbeSuccessDesc = prometheus.NewDesc(
+		"thousandeyes_probe_success",
+		"1 if all ThousandEyes API requests of the probe succeeded, 0 otherwise.",
+		nil,
+		nil)
+	ThousandProbeDurationDesc = prometheus.NewDesc(
+		"thousandeyes_probe_duration_seconds",
+		"Seconds the probe took to fetch the test results from the ThousandEyes API.",
+		nil,
+		nil)
+)
+
+// DefaultProbeModule is used by /probe requests without module parameter
+const DefaultProbeModule = "default"
+
+// ProbeModule says which result families are fetched for the tests of a /probe request
+type ProbeModule struct {
+	Families []string `yaml:"families"`
+}
+
+func (m ProbeModule) validate(handlers []TestHandler) error {
+	if len(m.Families) == 0 {
+		return fmt.Errorf("no result families")
+	}
+	return validateFamilies(m.Families, handlers)
+}
+
+func (m ProbeModule) has(family string) bool {
+	return hasFamily(m.Families, family)
+}
+
+// probeCollector fetches the results of the given tests synchronously on every scrape, like the blackbox_exporter does
+type probeCollector struct {
+	c *Collector
+	// parent is the collector of /metrics, the account groups cached by its poller are used
+	parent *Collector
+}
+
+// Describe sends nothing, the probe is an unchecked collector
+func (p probeCollector) Describe(ch chan<- *prometheus.Desc) {}
+
+func (p probeCollector) Collect(ch chan<- prometheus.Metric) {
+	probeStart := time.Now()
+
+	defer func() {
+		if r := recover(); r != nil {
+			ThousandRequestParsingFailMetric.Inc()
+			log.Println("ERROR: Thousand Eyes Parsing Error (", r, ").")
+		}
+	}()
+
+	success := 1.0
+	groups, _, bError := p.parent.cachedAccountGroups(p.c)
+	if bError {
+		success = 0
+	}
+	for _, ag := range groups {
+		results, _, bError := p.c.GetTests(ag)
+		if bError || results.failed() > 0 {
+			success = 0
+		}
+		collectTests(results, p.c.TestHandlers, ch)
+	}
+
+	ch <- prometheus.MustNewConstMetric(ThousandProbeSuccessDesc, prometheus.GaugeValue, success)
+	ch <- prometheus.MustNewConstMetric(ThousandProbeDurationDesc, prometheus.GaugeValue, time.Since(probeStart).Seconds())
+}
+
+// ProbeHandler serves /probe?test_id=<id>[,<id>...]&module=<name>
+// the results of the given tests are fetched from the API for every request, the module decides which result families
+func (t *Collector) ProbeHandler(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+
+	var testIDs []int
+	for _, param := range params["test_id"] {
+		for _, id := range strings.Split(param, ",") {
+			testID, err := strconv.Atoi(strings.TrimSpace(id))
+			if err != nil {
+				http.Error(w, fmt.Sprintf("test_id %q is not a number", id), http.StatusBadRequest)
+				return
+			}
+			testIDs = append(testIDs, testID)
+		}
+	}
+	if len(testIDs) == 0 {
+		http.Error(w, "test_id parameter is missing", http.StatusBadRequest)
+		return
+	}
+
+	moduleName := params.Get("module")
+	if moduleName == "" {
+		if _, ok := t.ProbeModules[DefaultProbeModule]; !ok {
+			http.Error(w, fmt.Sprintf("module parameter is missing (there is no module %q)", DefaultProbeModule), http.StatusBadRequest)
+			return
+		}
+		moduleName = DefaultProbeModule
+	}
+	module, ok := t.ProbeModules[moduleName]
+	if !ok {
+		http.Error(w, fmt.Sprintf("unknown module %q", moduleName), http.StatusBadRequest)
+		return
+	}
+
+	probe := &Collector{
+		IsBasicAuth:         t.IsBasicAuth,
+		Token:               t.Token,
+		User:                t.User,
+		ExpectedOriginAS:    t.ExpectedOriginAS,
+		AccountGroups:       t.AccountGroups,
+		TestFilter:          TestFilter{Include: TestMatcher{TestIDs: testIDs}},
+		MaxParallelRequests: t.MaxParallelRequests,
+		MaxPages:            t.MaxPages,
+		MaxTransactionSteps: t.MaxTransactionSteps,
+		APIVersion:          t.APIVersion,
+		retries:             NewRetryBudget(),
+	}
+
+	// the handlers of the collector are reused for the module families, including the ones registered in place of a built-in handler
+	var handlers []TestHandler
+	for _, h := range t.TestHandlers {
+		if module.has(h.Family()) {
+			handlers = append(handlers, h)
+		}
+	}
+	probe.TestHandlers = familyHandlers(probe, module.Families, handlers)
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(probeCollector{c: probe, parent: t})
+	promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+}
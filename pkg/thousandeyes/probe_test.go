@@ -0,0 +1,90 @@
+package thousandeyes
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestProbeHandlerBadRequests(t *testing.T) {
+	web := ProbeModule{Families: []string{FamilyHTTP}}
+
+	tests := []struct {
+		name     string
+		modules  map[string]ProbeModule
+		query    string
+		wantBody string
+	}{
+		{"test_id missing", map[string]ProbeModule{"web": web}, "module=web", "test_id parameter is missing"},
+		{"test_id not a number", map[string]ProbeModule{"web": web}, "test_id=1,x&module=web", `test_id "x" is not a number`},
+		{"module missing, no default module", map[string]ProbeModule{"web": web}, "test_id=1", "module parameter is missing"},
+		{"unknown module", map[string]ProbeModule{DefaultProbeModule: web}, "test_id=1&module=dns", `unknown module "dns"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Collector{ProbeModules: tt.modules}
+			w := httptest.NewRecorder()
+			c.ProbeHandler(w, httptest.NewRequest(http.MethodGet, "/probe?"+tt.query, nil))
+
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("status %d, want %d", w.Code, http.StatusBadRequest)
+			}
+			if !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("body %q, want %q", w.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
+// smtpHandler is an in-house handler of a test type the package does not know
+type smtpHandler struct{}
+
+var smtpResultsDesc = prometheus.NewDesc("inhouse_smtp_results", "Results of in-house smtp tests.", nil, nil)
+
+func (smtpHandler) Family() string      { return "smtp" }
+func (smtpHandler) TestTypes() []string { return []string{"smtp-server"} }
+func (smtpHandler) Request(ctx *TestContext, test ThousandTest) (Request, bool) {
+	return Request{URL: fmt.Sprintf("https://api.thousandeyes.com/v6/smtp/%d.json", test.TestID), ResponseObject: new(ThousandTests)}, true
+}
+func (smtpHandler) Decode(ctx *TestContext, r Request) interface{} { return r.ResponseObject }
+func (smtpHandler) Describe(ch chan<- *prometheus.Desc)            { ch <- smtpResultsDesc }
+func (smtpHandler) Collect(results []interface{}, ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(smtpResultsDesc, prometheus.GaugeValue, float64(len(results)))
+}
+
+func TestProbeHandlerRegisteredFamily(t *testing.T) {
+	redirectAPI(t, newTestAPI(t, map[string]string{
+		"/v6/account-groups.json": `{"accountGroups": [{"aid": 0, "accountGroupName": "ops", "default": 1}]}`,
+		"/v6/tests.json":          `{"test": [{"testId": 1, "type": "smtp-server"}, {"testId": 2, "type": "smtp-server"}]}`,
+		"/v6/smtp/1.json":         `{"test": []}`,
+	}))
+
+	cfg := &Config{
+		Credentials: CredentialsConfig{BearerToken: "token"},
+		Modules:     map[string]ProbeModule{"mail": {Families: []string{"smtp"}}},
+	}
+	if err := cfg.Validate(smtpHandler{}); err != nil {
+		t.Fatalf("config: %s", err)
+	}
+	c, err := cfg.NewCollector(smtpHandler{})
+	if err != nil {
+		t.Fatalf("collector: %s", err)
+	}
+
+	w := httptest.NewRecorder()
+	c.ProbeHandler(w, httptest.NewRequest(http.MethodGet, "/probe?test_id=1&module=mail", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	for _, want := range []string{"inhouse_smtp_results 1", "thousandeyes_probe_success 1"} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("body does not contain %q:\n%s", want, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package thousandeyes
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	headerRateLimitLimit     = "X-Organization-Rate-Limit-Limit"
+	headerRateLimitRemaining = "X-Organization-Rate-Limit-Remaining"
+	headerRateLimitReset     = "X-Organization-Rate-Limit-Reset"
+
+	// ThousandEyes default organisation limit, used until the first response tells us better
+	defaultRateLimitPerMinute = 240
+	rateLimitWindow           = time.Minute
+)
+
+// APIRateLimiter is shared by all calls against the ThousandEyes API
+var APIRateLimiter = NewRateLimiter(defaultRateLimitPerMinute)
+
+// RateLimiter is a token bucket refilled with limit tokens per minute
+// the bucket is corrected by the rate limit headers ThousandEyes sends with each response,
+// so requests of other API consumers of the organisation are taken into account, too
+type RateLimiter struct {
+	mu           sync.Mutex
+	limit        int
+	tokens       float64
+	lastRefill   time.Time
+	blockedUntil time.Time
+}
+
+// NewRateLimiter returns a full bucket for limit requests per minute
+func NewRateLimiter(limit int) *RateLimiter {
+	return &RateLimiter{
+		limit:      limit,
+		tokens:     float64(limit),
+		lastRefill: time.Now(),
+	}
+}
+
+// Wait blocks until the next request fits into the budget
+func (l *RateLimiter) Wait() {
+	for {
+		d := l.reserve()
+		if d <= 0 {
+			return
+		}
+		time.Sleep(d)
+	}
+}
+
+// reserve takes a token and returns 0 or returns the time to wait before asking again
+func (l *RateLimiter) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Before(l.blockedUntil) {
+		return l.blockedUntil.Sub(now)
+	}
+
+	l.refill(now)
+	if l.tokens >= 1 {
+		l.tokens--
+		return 0
+	}
+	return time.Duration((1 - l.tokens) / l.ratePerSecond() * float64(time.Second))
+}
+
+func (l *RateLimiter) refill(now time.Time) {
+	l.tokens += now.Sub(l.lastRefill).Seconds() * l.ratePerSecond()
+	if l.tokens > float64(l.limit) {
+		l.tokens = float64(l.limit)
+	}
+	l.lastRefill = now
+}
+
+func (l *RateLimiter) ratePerSecond() float64 {
+	return float64(l.limit) / rateLimitWindow.Seconds()
+}
+
+// Update adjusts the bucket to the rate limit headers of a ThousandEyes response
+func (l *RateLimiter) Update(h http.Header) {
+	limit, errLimit := strconv.Atoi(h.Get(headerRateLimitLimit))
+	remaining, errRemaining := strconv.Atoi(h.Get(headerRateLimitRemaining))
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if errLimit == nil && limit > 0 {
+		l.limit = limit
+		ThousandRequestAPILimit.Set(float64(limit))
+	}
+	if errRemaining == nil {
+		ThousandRequestAPILimitRemaining.Set(float64(remaining))
+		l.refill(time.Now())
+		if float64(remaining) < l.tokens {
+			l.tokens = float64(remaining)
+		}
+		if remaining <= 0 {
+			l.blockedUntil = resetTime(h)
+		}
+	}
+}
+
+// BlockUntilReset stops all requests until the reset time of the rate limit window after a 429
+// and returns that time
+func (l *RateLimiter) BlockUntilReset(h http.Header) time.Time {
+	reset := resetTime(h)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.tokens = 0
+	if reset.After(l.blockedUntil) {
+		l.blockedUntil = reset
+	}
+	ThousandRequestAPILimitRemaining.Set(0)
+	return l.blockedUntil
+}
+
+// resetTime parses the epoch seconds of the reset header, without a header we wait a whole window
+func resetTime(h http.Header) time.Time {
+	reset, err := strconv.ParseInt(h.Get(headerRateLimitReset), 10, 64)
+	if err != nil || reset <= 0 {
+		return time.Now().Add(rateLimitWindow)
+	}
+	return time.Unix(reset, 0)
+}
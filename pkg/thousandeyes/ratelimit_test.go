@@ -0,0 +1,161 @@
+package thousandeyes
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func rateLimitHeaders(limit, remaining, reset string) http.Header {
+	h := http.Header{}
+	if limit != "" {
+		h.Set(headerRateLimitLimit, limit)
+	}
+	if remaining != "" {
+		h.Set(headerRateLimitRemaining, remaining)
+	}
+	if reset != "" {
+		h.Set(headerRateLimitReset, reset)
+	}
+	return h
+}
+
+func TestRateLimiterReserve(t *testing.T) {
+	tests := []struct {
+		name     string
+		limit    int
+		requests int
+		wantWait bool
+	}{
+		{"within the bucket", 60, 60, false},
+		{"bucket used up", 60, 61, true},
+		{"single token", 1, 2, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewRateLimiter(tt.limit)
+			var wait time.Duration
+			for i := 0; i < tt.requests; i++ {
+				wait = l.reserve()
+			}
+			if (wait > 0) != tt.wantWait {
+				t.Fatalf("wait %s, want a wait %t", wait, tt.wantWait)
+			}
+			// an empty bucket gets the next token after 1/rate
+			if max := rateLimitWindow / time.Duration(tt.limit); wait > max {
+				t.Errorf("wait %s, want at most %s", wait, max)
+			}
+		})
+	}
+}
+
+func TestRateLimiterUpdate(t *testing.T) {
+	reset := time.Now().Add(30 * time.Second).Truncate(time.Second)
+	epoch := strconv.FormatInt(reset.Unix(), 10)
+
+	tests := []struct {
+		name        string
+		header      http.Header
+		wantLimit   int
+		wantTokens  float64
+		wantBlocked bool
+	}{
+		{"no headers", rateLimitHeaders("", "", ""), 240, 240, false},
+		{"not a number", rateLimitHeaders("many", "some", ""), 240, 240, false},
+		{"limit raised", rateLimitHeaders("600", "", ""), 600, 240, false},
+		{"other consumers used the budget", rateLimitHeaders("240", "10", epoch), 240, 10, false},
+		{"remaining above the bucket", rateLimitHeaders("240", "500", epoch), 240, 240, false},
+		{"budget used up", rateLimitHeaders("240", "0", epoch), 240, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewRateLimiter(240)
+			l.Update(tt.header)
+
+			if l.limit != tt.wantLimit {
+				t.Errorf("limit %d, want %d", l.limit, tt.wantLimit)
+			}
+			// the refill of the few microseconds of the test is tolerated
+			if l.tokens < tt.wantTokens || l.tokens > tt.wantTokens+0.1 {
+				t.Errorf("tokens %f, want %f", l.tokens, tt.wantTokens)
+			}
+			if blocked := !l.blockedUntil.IsZero(); blocked != tt.wantBlocked {
+				t.Fatalf("blocked %t, want %t", blocked, tt.wantBlocked)
+			}
+			if tt.wantBlocked {
+				if !l.blockedUntil.Equal(reset) {
+					t.Errorf("blocked until %s, want %s", l.blockedUntil, reset)
+				}
+				if wait := l.reserve(); wait <= 0 || wait > 30*time.Second {
+					t.Errorf("wait %s, want the time until the reset", wait)
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimiterBlockUntilReset(t *testing.T) {
+	now := time.Now()
+	soon := now.Add(10 * time.Second).Truncate(time.Second)
+	later := now.Add(40 * time.Second).Truncate(time.Second)
+
+	tests := []struct {
+		name         string
+		blockedUntil time.Time
+		reset        time.Time
+		want         time.Time
+	}{
+		{"not blocked", time.Time{}, soon, soon},
+		{"blocked shorter", soon, later, later},
+		{"blocked longer", later, soon, later},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewRateLimiter(240)
+			l.blockedUntil = tt.blockedUntil
+
+			got := l.BlockUntilReset(rateLimitHeaders("", "", strconv.FormatInt(tt.reset.Unix(), 10)))
+			if !got.Equal(tt.want) {
+				t.Errorf("blocked until %s, want %s", got, tt.want)
+			}
+			if l.tokens != 0 {
+				t.Errorf("tokens %f, want 0", l.tokens)
+			}
+		})
+	}
+}
+
+func TestResetTime(t *testing.T) {
+	tests := []struct {
+		name       string
+		reset      string
+		want       time.Time
+		wantWindow bool
+	}{
+		{"epoch seconds", "1700000000", time.Unix(1700000000, 0), false},
+		{"missing", "", time.Time{}, true},
+		{"not a number", "soon", time.Time{}, true},
+		{"zero", "0", time.Time{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := time.Now()
+			got := resetTime(rateLimitHeaders("", "", tt.reset))
+			if tt.wantWindow {
+				// without a usable header a whole window is waited
+				if got.Before(before.Add(rateLimitWindow)) || got.After(time.Now().Add(rateLimitWindow)) {
+					t.Errorf("reset %s, want now + %s", got, rateLimitWindow)
+				}
+				return
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("reset %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
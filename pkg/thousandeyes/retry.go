@@ -0,0 +1,112 @@
+package thousandeyes
+
+import (
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy describes how transient failures of the ThousandEyes API (5xx, timeouts, connection resets) are retried
+type RetryPolicy struct {
+	// MaxAttempts is the number of tries of one request including the first one
+	MaxAttempts int
+	// BaseDelay is doubled for every retry up to MaxDelay, the actual wait is a random jitter below that
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// Budget is the number of retries allowed for all requests of one refresh or /probe request, see RetryBudget
+	Budget int64
+}
+
+var (
+	// APIRetryPolicy is used by CallSingle
+	APIRetryPolicy = RetryPolicy{
+		MaxAttempts: 4,
+		BaseDelay:   500 * time.Millisecond,
+		MaxDelay:    10 * time.Second,
+		Budget:      50,
+	}
+
+	// APIRequestTimeout is the timeout of a single http request against the ThousandEyes API
+	APIRequestTimeout = 30 * time.Second
+)
+
+func init() {
+	rand.Seed(time.Now().UnixNano())
+}
+
+// RetryBudget are the retries left for the requests of one refresh or /probe request,
+// every refresh and probe gets its own, so a burst of probes cannot use up the retries of the poller
+type RetryBudget struct {
+	left int64
+}
+
+// NewRetryBudget returns a budget of APIRetryPolicy.Budget retries
+func NewRetryBudget() *RetryBudget {
+	return &RetryBudget{left: APIRetryPolicy.Budget}
+}
+
+// take returns false if the retries are used up, a nil budget allows no retries
+func (b *RetryBudget) take() bool {
+	if b == nil {
+		return false
+	}
+	return atomic.AddInt64(&b.left, -1) >= 0
+}
+
+// backoff returns the wait before retry number attempt (starting at 0): full jitter on a capped exponential
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.BaseDelay << uint(attempt)
+	if d <= 0 || d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(d))) + 1
+}
+
+// failureCode is the code label of the retry and failure counters: the http status code or the kind of transport error
+func failureCode(resp *http.Response, err error) string {
+	if err == nil {
+		return strconv.Itoa(resp.StatusCode)
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return "timeout"
+	}
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return "connection_reset"
+	}
+	return "transport_error"
+}
+
+// isRetryable tells if the request may succeed when tried again
+func isRetryable(resp *http.Response, err error) bool {
+	if err != nil {
+		code := failureCode(resp, err)
+		return code == "timeout" || code == "connection_reset"
+	}
+	return resp.StatusCode >= 500
+}
+
+// failureHint explains the status codes we do not retry
+func failureHint(statusCode int) string {
+	switch statusCode {
+	case http.StatusUnauthorized:
+		return "not retried - check the ThousandEyes credentials"
+	case http.StatusForbidden:
+		return "not retried - the ThousandEyes user is not allowed to access this resource"
+	case http.StatusNotFound:
+		return "not retried - the resource does not exist (deleted test?)"
+	}
+	if statusCode >= 500 {
+		return "retries exhausted"
+	}
+	return "not retried"
+}
@@ -0,0 +1,183 @@
+package thousandeyes
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// timeoutError is a net.Error that timed out
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestRetryClassification(t *testing.T) {
+	tests := []struct {
+		name          string
+		status        int
+		err           error
+		wantCode      string
+		wantRetryable bool
+	}{
+		{"ok", http.StatusOK, nil, "200", false},
+		{"unauthorized", http.StatusUnauthorized, nil, "401", false},
+		{"not found", http.StatusNotFound, nil, "404", false},
+		{"too many requests", http.StatusTooManyRequests, nil, "429", false},
+		{"internal server error", http.StatusInternalServerError, nil, "500", true},
+		{"service unavailable", http.StatusServiceUnavailable, nil, "503", true},
+		{"timeout", 0, &url.Error{Op: "Get", URL: "https://api", Err: timeoutError{}}, "timeout", true},
+		{"connection reset", 0, &url.Error{Op: "Get", URL: "https://api", Err: syscall.ECONNRESET}, "connection_reset", true},
+		{"EOF", 0, fmt.Errorf("read body: %w", io.EOF), "connection_reset", true},
+		{"unexpected EOF", 0, io.ErrUnexpectedEOF, "connection_reset", true},
+		{"other transport error", 0, errors.New("no such host"), "transport_error", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var resp *http.Response
+			if tt.err == nil {
+				resp = &http.Response{StatusCode: tt.status}
+			}
+			if code := failureCode(resp, tt.err); code != tt.wantCode {
+				t.Errorf("code %q, want %q", code, tt.wantCode)
+			}
+			if retryable := isRetryable(resp, tt.err); retryable != tt.wantRetryable {
+				t.Errorf("retryable %t, want %t", retryable, tt.wantRetryable)
+			}
+		})
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	defer func(budget int64) { APIRetryPolicy.Budget = budget }(APIRetryPolicy.Budget)
+
+	tests := []struct {
+		name   string
+		budget int64
+		takes  int
+		want   []bool
+	}{
+		{"no budget", 0, 2, []bool{false, false}},
+		{"budget used up", 2, 3, []bool{true, true, false}},
+		{"budget left", 3, 2, []bool{true, true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			APIRetryPolicy.Budget = tt.budget
+			b := NewRetryBudget()
+			for i := 0; i < tt.takes; i++ {
+				if got := b.take(); got != tt.want[i] {
+					t.Errorf("retry %d allowed %t, want %t", i, got, tt.want[i])
+				}
+			}
+		})
+	}
+
+	var none *RetryBudget
+	if none.take() {
+		t.Errorf("retry allowed without budget")
+	}
+}
+
+func TestRetryBudgetPerRefreshAndProbe(t *testing.T) {
+	defer func(policy RetryPolicy) { APIRetryPolicy = policy }(APIRetryPolicy)
+	APIRetryPolicy = RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond, Budget: 2}
+
+	// the test list is unavailable, every request of it is tried as long as the budget allows
+	var mu sync.Mutex
+	var testListCalls int
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v6/account-groups.json" {
+			_, _ = w.Write([]byte(`{"accountGroups": [{"aid": 0, "accountGroupName": "ops", "default": 1}]}`))
+			return
+		}
+		mu.Lock()
+		testListCalls++
+		mu.Unlock()
+		http.Error(w, "maintenance", http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(s.Close)
+	redirectAPI(t, s)
+
+	c := &Collector{Token: "token", ProbeModules: map[string]ProbeModule{DefaultProbeModule: {Families: []string{FamilyHTTP}}}}
+	c.TestHandlers = []TestHandler{newHTTPHandler()}
+
+	calls := func(run func()) int {
+		mu.Lock()
+		before := testListCalls
+		mu.Unlock()
+		run()
+		mu.Lock()
+		defer mu.Unlock()
+		return testListCalls - before
+	}
+	probe := func() {
+		c.ProbeHandler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/probe?test_id=1", nil))
+	}
+
+	// each probe and refresh gets 2 retries, the probes before do not use up the ones of the refresh
+	for i, run := range []func(){probe, probe, probe, func() { c.refresh(false, true) }, probe} {
+		if got := calls(run); got != 3 {
+			t.Errorf("run %d: %d requests of the test list, want 3", i, got)
+		}
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	p := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+
+	tests := []struct {
+		attempt int
+		max     time.Duration
+	}{
+		{0, 100 * time.Millisecond},
+		{1, 200 * time.Millisecond},
+		{3, 800 * time.Millisecond},
+		{4, time.Second},
+		// the shift overflows
+		{70, time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.attempt), func(t *testing.T) {
+			for i := 0; i < 100; i++ {
+				if d := p.backoff(tt.attempt); d <= 0 || d > tt.max {
+					t.Fatalf("backoff %s, want in (0, %s]", d, tt.max)
+				}
+			}
+		})
+	}
+
+	if d := (RetryPolicy{}).backoff(2); d != 0 {
+		t.Errorf("backoff without delays %s, want 0", d)
+	}
+}
+
+func TestFailureHint(t *testing.T) {
+	tests := []struct {
+		status int
+		want   string
+	}{
+		{http.StatusUnauthorized, "not retried - check the ThousandEyes credentials"},
+		{http.StatusForbidden, "not retried - the ThousandEyes user is not allowed to access this resource"},
+		{http.StatusNotFound, "not retried - the resource does not exist (deleted test?)"},
+		{http.StatusBadRequest, "not retried"},
+		{http.StatusBadGateway, "retries exhausted"},
+	}
+
+	for _, tt := range tests {
+		if got := failureHint(tt.status); got != tt.want {
+			t.Errorf("hint of %d %q, want %q", tt.status, got, tt.want)
+		}
+	}
+}
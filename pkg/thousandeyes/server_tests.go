@@ -0,0 +1,172 @@
+package thousandeyes
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"log"
+)
+
+// sip-server and ftp-server tests differ by their URLs and the object wrapping the results of the v6 response only,
+// they share the result type, the metrics and the handler
+
+// ServerTestDescs are the descriptors of the metrics of a server test type
+type ServerTestDescs struct {
+	Available    *prometheus.Desc
+	ResponseTime *prometheus.Desc
+	ConnectTime  *prometheus.Desc
+	ResponseCode *prometheus.Desc
+	ErrorInfo    *prometheus.Desc
+}
+
+// newServerTestDescs names the metrics thousandeyes_test_<protocol>_*, server is the name of the server in the help texts
+func newServerTestDescs(protocol string, server string) ServerTestDescs {
+	prefix := "thousandeyes_test_" + protocol + "_"
+	help := server + " test ran in ThousandEyes - "
+	return ServerTestDescs{
+		Available: prometheus.NewDesc(
+			prefix+"available",
+			help+"1 if the agent reached the "+server+" without error, 0 otherwise.",
+			agentTestLabels,
+			nil),
+		ResponseTime: prometheus.NewDesc(
+			prefix+"response_time_milliseconds",
+			help+"metric: responseTime.",
+			agentTestLabels,
+			nil),
+		ConnectTime: prometheus.NewDesc(
+			prefix+"connect_time_milliseconds",
+			help+"metric: connectTime.",
+			agentTestLabels,
+			nil),
+		ResponseCode: prometheus.NewDesc(
+			prefix+"response_code",
+			help+"metric: responseCode.",
+			agentTestLabels,
+			nil),
+		ErrorInfo: prometheus.NewDesc(
+			prefix+"error_info",
+			help+"always 1, only present if the agent saw an error, its type is the label error_type.",
+			append(append([]string{}, agentTestLabels...), "error_type"),
+			nil),
+	}
+}
+
+func (d ServerTestDescs) list() []*prometheus.Desc {
+	return []*prometheus.Desc{d.Available, d.ResponseTime, d.ConnectTime, d.ResponseCode, d.ErrorInfo}
+}
+
+// ServerTestResults are the results of a sip-server or ftp-server test
+type ServerTestResults struct {
+	Test    ThousandTest
+	Results []ServerResult
+	// AccountGroup the test belongs to
+	AccountGroup AccountGroup
+}
+
+// ServerResult server response seen by an agent
+type ServerResult struct {
+	ConnectTime  int    `json:"connectTime"`
+	DNSTime      int    `json:"dnsTime"`
+	ResponseCode int    `json:"responseCode"`
+	ResponseTime int    `json:"responseTime"`
+	TotalTime    int    `json:"totalTime"`
+	ErrorType    string `json:"errorType"`
+	AgentName    string `json:"agentName"`
+	CountryID    string `json:"countryId"`
+	Date         string `json:"date"`
+	AgentID      int    `json:"agentId"`
+	RoundID      int    `json:"roundId"`
+}
+
+// v7ServerResults are the v7 results of sip-server and ftp-server tests, they have the same shape
+type v7ServerResults struct {
+	Test    v7Test `json:"test"`
+	Results []struct {
+		ServerResult
+		AgentID string `json:"agentId"`
+	} `json:"results"`
+	Links v7Links `json:"_links"`
+}
+
+func (r *v7ServerResults) nextPage() string { return r.Links.Next.Href }
+func (r *v7ServerResults) appendPage(page interface{}) {
+	r.Results = append(r.Results, page.(*v7ServerResults).Results...)
+}
+
+func (r *v7ServerResults) result(ctx *TestContext) interface{} {
+	res := &ServerTestResults{Test: r.Test.toV6()}
+	for _, m := range r.Results {
+		server := m.ServerResult
+		server.AgentID = v7ID(m.AgentID)
+		agent := ctx.v7Agent(m.AgentID)
+		server.AgentName = agent.AgentName
+		server.CountryID = agent.CountryID
+		res.Results = append(res.Results, server)
+	}
+	return res
+}
+
+// newServerTestHandler collects the results of the server tests of testType,
+// the v6 response has to convert to ServerTestResults, the v7 response is v7ServerResults
+func newServerTestHandler(family string, testType string, descs ServerTestDescs, v6 resultRequest, v7URL string) TestHandler {
+	return resultHandler{
+		handlerInfo: handlerInfo{
+			family:    family,
+			testTypes: []string{testType},
+			descs:     descs.list(),
+		},
+		requests: resultRequests{
+			APIVersion6: v6,
+			APIVersion7: {v7URL, func() interface{} { return new(v7ServerResults) }},
+		},
+		collect: descs.collect,
+	}
+}
+
+func (d ServerTestDescs) collect(tServer []ServerTestResults, ch chan<- prometheus.Metric) {
+
+	for e := range tServer {
+		if len(tServer[e].Results) == 0 {
+			log.Println("INFO: Server metrics are empty for Test:", tServer[e])
+			continue
+		}
+		for _, s := range tServer[e].Results {
+
+			labels := agentTestLabelValues(tServer[e].Test, s.CountryID, s.AgentName, tServer[e].AccountGroup)
+
+			available := 1.0
+			if isErrorType(s.ErrorType) {
+				available = 0
+				ch <- prometheus.MustNewConstMetric(
+					d.ErrorInfo,
+					prometheus.GaugeValue,
+					1,
+					append(labels, s.ErrorType)...,
+				)
+			}
+			ch <- prometheus.MustNewConstMetric(
+				d.Available,
+				prometheus.GaugeValue,
+				available,
+				labels...,
+			)
+			ch <- prometheus.MustNewConstMetric(
+				d.ResponseTime,
+				prometheus.GaugeValue,
+				float64(s.ResponseTime),
+				labels...,
+			)
+			ch <- prometheus.MustNewConstMetric(
+				d.ConnectTime,
+				prometheus.GaugeValue,
+				float64(s.ConnectTime),
+				labels...,
+			)
+			ch <- prometheus.MustNewConstMetric(
+				d.ResponseCode,
+				prometheus.GaugeValue,
+				float64(s.ResponseCode),
+				labels...,
+			)
+		}
+	}
+}
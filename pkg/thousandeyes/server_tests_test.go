@@ -0,0 +1,61 @@
+package thousandeyes
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestServerTestHandlers(t *testing.T) {
+	tests := []struct {
+		handler  TestHandler
+		response interface{}
+		protocol string
+	}{
+		{newSIPServerHandler(), &SIPServerTestResults{}, "sip"},
+		{newFTPServerHandler(), &FTPServerTestResults{}, "ftp"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.protocol, func(t *testing.T) {
+			results := []ServerResult{
+				{AgentName: "Frankfurt", ResponseTime: 12, ResponseCode: 200},
+				{AgentName: "Tokyo", ErrorType: "Connect"},
+			}
+			switch r := tt.response.(type) {
+			case *SIPServerTestResults:
+				r.Voice.SIPServer = results
+			case *FTPServerTestResults:
+				r.Web.FTPServer = results
+			}
+
+			ctx := &TestContext{APIVersion: APIVersion6}
+			res := tt.handler.Decode(ctx, Request{ResponseObject: tt.response})
+			if res == nil {
+				t.Fatalf("response %T not decoded", tt.response)
+			}
+
+			registry := prometheus.NewRegistry()
+			registry.MustRegister(collectorFunc(func(ch chan<- prometheus.Metric) {
+				tt.handler.Collect([]interface{}{res}, ch)
+			}))
+			families, err := registry.Gather()
+			if err != nil {
+				t.Fatalf("gather: %s", err)
+			}
+
+			var names []string
+			for _, f := range families {
+				names = append(names, f.GetName())
+			}
+			sort.Strings(names)
+			prefix := "thousandeyes_test_" + tt.protocol + "_"
+			want := []string{prefix + "available", prefix + "connect_time_milliseconds", prefix + "error_info", prefix + "response_code", prefix + "response_time_milliseconds"}
+			if strings.Join(names, ",") != strings.Join(want, ",") {
+				t.Errorf("metrics %v, want %v", names, want)
+			}
+		})
+	}
+}
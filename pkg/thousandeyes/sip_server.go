@@ -0,0 +1,36 @@
+package thousandeyes
+
+const (
+	apiURLTestSIPServer   = "https://api.thousandeyes.com/v6/voice/sip-server/%d.json"
+	apiURLv7TestSIPServer = "https://api.thousandeyes.com/v7/test-results/%d/sip-server"
+)
+
+// - sip server tests
+var ThousandTestSIPServerDescs = newServerTestDescs("sip", "SIP server")
+
+//https://api.thousandeyes.com/v6/voice/sip-server/612434.json
+
+// SIPServerTestResults SIP server test details
+type SIPServerTestResults struct {
+	Voice struct {
+		Test      ThousandTest   `json:"test"`
+		SIPServer []ServerResult `json:"sipServer"`
+	} `json:"voice"`
+	Pages Pages `json:"pages"`
+}
+
+func (r *SIPServerTestResults) nextPage() string { return r.Pages.Next }
+func (r *SIPServerTestResults) appendPage(page interface{}) {
+	r.Voice.SIPServer = append(r.Voice.SIPServer, page.(*SIPServerTestResults).Voice.SIPServer...)
+}
+
+func (r *SIPServerTestResults) result(ctx *TestContext) interface{} {
+	return &ServerTestResults{Test: r.Voice.Test, Results: r.Voice.SIPServer}
+}
+
+// newSIPServerHandler collects the results of sip-server tests
+func newSIPServerHandler() TestHandler {
+	return newServerTestHandler(FamilySIPServer, "sip-server", ThousandTestSIPServerDescs,
+		resultRequest{apiURLTestSIPServer, func() interface{} { return new(SIPServerTestResults) }},
+		apiURLv7TestSIPServer)
+}
@@ -0,0 +1,104 @@
+package thousandeyes
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// TestFilter decides which tests of /tests.json get their details fetched
+// a test is selected if it matches Include (or Include is empty) and does not match Exclude
+type TestFilter struct {
+	Include TestMatcher
+	Exclude TestMatcher
+}
+
+// TestMatcher criteria of a TestFilter, unset criteria are ignored
+type TestMatcher struct {
+	TestIDs   []int
+	NameRegex *regexp.Regexp
+	Types     []string
+	// Labels are ThousandEyes test labels (groups in API v6), by name or id
+	Labels []string
+}
+
+// NewTestMatcher compiles the name regex
+func NewTestMatcher(testIDs []int, nameRegex string, types []string, labels []string) (TestMatcher, error) {
+	m := TestMatcher{
+		TestIDs: testIDs,
+		Types:   types,
+		Labels:  labels,
+	}
+	if nameRegex != "" {
+		r, err := regexp.Compile(nameRegex)
+		if err != nil {
+			return m, fmt.Errorf("test name regex %q is not valid: %s", nameRegex, err)
+		}
+		m.NameRegex = r
+	}
+	return m, nil
+}
+
+// Select returns the selected tests
+func (f TestFilter) Select(tests []ThousandTest) []ThousandTest {
+	var selected []ThousandTest
+	for _, test := range tests {
+		if !f.Include.isEmpty() && !f.Include.matchesAll(test) {
+			continue
+		}
+		if !f.Exclude.isEmpty() && f.Exclude.matchesAny(test) {
+			continue
+		}
+		selected = append(selected, test)
+	}
+	return selected
+}
+
+func (m TestMatcher) isEmpty() bool {
+	return len(m.TestIDs) == 0 && m.NameRegex == nil && len(m.Types) == 0 && len(m.Labels) == 0
+}
+
+// matchesAll is true if the test matches every criterion set (include)
+func (m TestMatcher) matchesAll(test ThousandTest) bool {
+	return (len(m.TestIDs) == 0 || m.matchesTestID(test)) &&
+		(m.NameRegex == nil || m.NameRegex.MatchString(test.TestName)) &&
+		(len(m.Types) == 0 || m.matchesType(test)) &&
+		(len(m.Labels) == 0 || m.matchesLabel(test))
+}
+
+// matchesAny is true if the test matches at least one criterion set (exclude)
+func (m TestMatcher) matchesAny(test ThousandTest) bool {
+	return m.matchesTestID(test) ||
+		(m.NameRegex != nil && m.NameRegex.MatchString(test.TestName)) ||
+		m.matchesType(test) ||
+		m.matchesLabel(test)
+}
+
+func (m TestMatcher) matchesTestID(test ThousandTest) bool {
+	for _, id := range m.TestIDs {
+		if id == test.TestID {
+			return true
+		}
+	}
+	return false
+}
+
+func (m TestMatcher) matchesType(test ThousandTest) bool {
+	for _, t := range m.Types {
+		if t == test.Type {
+			return true
+		}
+	}
+	return false
+}
+
+func (m TestMatcher) matchesLabel(test ThousandTest) bool {
+	for _, label := range m.Labels {
+		for _, g := range test.Groups {
+			if label == g.Name || label == strconv.Itoa(g.GroupID) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+package thousandeyes
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTestFilterSelect(t *testing.T) {
+	tests := []ThousandTest{
+		{TestID: 1, TestName: "web prod", Type: "http-server", Groups: []TestGroup{{GroupID: 10, Name: "prod"}}},
+		{TestID: 2, TestName: "web staging", Type: "http-server", Groups: []TestGroup{{GroupID: 11, Name: "staging"}}},
+		{TestID: 3, TestName: "dns prod", Type: "dns-server", Groups: []TestGroup{{GroupID: 10, Name: "prod"}}},
+		{TestID: 4, TestName: "voice", Type: "voice"},
+	}
+
+	matcher := func(testIDs []int, nameRegex string, types []string, labels []string) TestMatcher {
+		m, err := NewTestMatcher(testIDs, nameRegex, types, labels)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+
+	filters := []struct {
+		name   string
+		filter TestFilter
+		want   []int
+	}{
+		{"no filter", TestFilter{}, []int{1, 2, 3, 4}},
+		{"include ids", TestFilter{Include: matcher([]int{2, 4}, "", nil, nil)}, []int{2, 4}},
+		{"include name", TestFilter{Include: matcher(nil, "^web ", nil, nil)}, []int{1, 2}},
+		{"include type", TestFilter{Include: matcher(nil, "", []string{"dns-server", "voice"}, nil)}, []int{3, 4}},
+		{"include label name", TestFilter{Include: matcher(nil, "", nil, []string{"prod"})}, []int{1, 3}},
+		{"include label id", TestFilter{Include: matcher(nil, "", nil, []string{"11"})}, []int{2}},
+		{"include matches all criteria", TestFilter{Include: matcher(nil, "prod", []string{"http-server"}, nil)}, []int{1}},
+		{"exclude id", TestFilter{Exclude: matcher([]int{1}, "", nil, nil)}, []int{2, 3, 4}},
+		{"exclude matches any criterion", TestFilter{Exclude: matcher(nil, "staging", []string{"voice"}, nil)}, []int{1, 3}},
+		{"exclude label", TestFilter{Exclude: matcher(nil, "", nil, []string{"prod"})}, []int{2, 4}},
+		{
+			"exclude wins over include",
+			TestFilter{Include: matcher(nil, "", []string{"http-server"}, nil), Exclude: matcher(nil, "", nil, []string{"staging"})},
+			[]int{1},
+		},
+		{"nothing selected", TestFilter{Include: matcher([]int{99}, "", nil, nil)}, nil},
+	}
+
+	for _, tt := range filters {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []int
+			for _, test := range tt.filter.Select(tests) {
+				got = append(got, test.TestID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("selected %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewTestMatcherInvalidRegex(t *testing.T) {
+	if _, err := NewTestMatcher(nil, "web(", nil, nil); err == nil {
+		t.Error("invalid regex accepted")
+	}
+}
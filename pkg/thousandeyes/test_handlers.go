@@ -0,0 +1,312 @@
+package thousandeyes
+
+import (
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"log"
+	"reflect"
+)
+
+// TestHandler collects a result family for the tests of some test types
+// the built-in families are handlers as well, in-house handlers are registered with Config.NewCollector
+// (or set in Collector.TestHandlers) and need no change of this package
+type TestHandler interface {
+	// Family names the results, it is the name used in the families of the config and probe modules
+	Family() string
+	// TestTypes are the ThousandEyes test types (http-server, agent-to-server, ...) the handler fetches results for
+	TestTypes() []string
+	// Request builds the request of the results of a test, false if the API version of the context does not offer them
+	// the Collector adds the account group to the URL
+	Request(ctx *TestContext, test ThousandTest) (Request, bool)
+	// Decode turns the response object of a finished request into the result kept in the snapshot
+	Decode(ctx *TestContext, r Request) interface{}
+	// Describe sends the descriptors of all metrics Collect emits
+	Describe(ch chan<- *prometheus.Desc)
+	// Collect emits the metrics of the decoded results of all account groups
+	Collect(results []interface{}, ch chan<- prometheus.Metric)
+}
+
+// TestContext is the account group and API version the test results of a refresh are fetched for
+type TestContext struct {
+	AccountGroup AccountGroup
+	// APIVersion is the ThousandEyes API version in use (v6|v7)
+	APIVersion string
+
+	collector *Collector
+	backend   backend
+	agents    map[int]ThousandAgent
+}
+
+func (t *Collector) newTestContext(b backend, ag AccountGroup) *TestContext {
+	ctx := &TestContext{AccountGroup: ag, APIVersion: t.APIVersion, collector: t, backend: b}
+	if ctx.APIVersion == "" {
+		ctx.APIVersion = APIVersion6
+	}
+	return ctx
+}
+
+// Agent returns the agent of the account group with the id, the agents are fetched once on first use
+func (c *TestContext) Agent(id int) (ThousandAgent, bool) {
+	if c.agents == nil {
+		agents, _, bError := c.backend.getAgents(c.collector, c.AccountGroup)
+		if bError {
+			log.Println(fmt.Sprintf("ERROR: Agents of account group %s could not be fetched, results are labelled with agent ids.", c.AccountGroup.Name))
+		}
+		c.agents = agents
+		if c.agents == nil {
+			c.agents = map[int]ThousandAgent{}
+		}
+	}
+	a, ok := c.agents[id]
+	return a, ok
+}
+
+// agentName is the name of the agent, its id if it is not known
+func (c *TestContext) agentName(id int) string {
+	if a, ok := c.Agent(id); ok {
+		return a.AgentName
+	}
+	return fmt.Sprintf("%d", id)
+}
+
+// v7Agent looks an agent up by its v7 id
+func (c *TestContext) v7Agent(id string) ThousandAgent {
+	a, _ := c.Agent(v7ID(id))
+	return a
+}
+
+// resultConverter is a response object of another shape than the result the metrics are built from, e.g. a v7 response
+type resultConverter interface {
+	result(ctx *TestContext) interface{}
+}
+
+// decodedResult returns the result of a finished request, converted if the response object is a resultConverter
+func decodedResult(ctx *TestContext, r Request) interface{} {
+	if o, ok := r.ResponseObject.(resultConverter); ok {
+		return o.result(ctx)
+	}
+	return r.ResponseObject
+}
+
+// handlerInfo is the static part of the built-in handlers
+type handlerInfo struct {
+	family    string
+	testTypes []string
+	descs     []*prometheus.Desc
+}
+
+func (h handlerInfo) Family() string      { return h.family }
+func (h handlerInfo) TestTypes() []string { return h.testTypes }
+func (h handlerInfo) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range h.descs {
+		ch <- d
+	}
+}
+
+// resultHandler is a TestHandler made of the requests of the results per API version and the func collecting them,
+// the built-in families are resultHandlers
+type resultHandler struct {
+	handlerInfo
+	// requests of the results by API version, an API version without request does not offer the results
+	requests resultRequests
+	// typeRequests replace requests for the test types whose results come from another endpoint
+	typeRequests map[string]resultRequests
+	// complete adds what the response does not tell to the decoded result (a pointer to it), optional
+	complete func(ctx *TestContext, result interface{})
+	// collect is a func([]T, chan<- prometheus.Metric), T is the type of the decoded results
+	collect interface{}
+}
+
+// resultRequests are the requests of the results by API version (v6|v7)
+type resultRequests map[string]resultRequest
+
+// resultRequest is the URL of the results - %d is the test id - and the constructor of its response object
+type resultRequest struct {
+	url         string
+	newResponse func() interface{}
+}
+
+func (h resultHandler) Request(ctx *TestContext, test ThousandTest) (Request, bool) {
+	requests, ok := h.typeRequests[test.Type]
+	if !ok {
+		requests = h.requests
+	}
+	r, ok := requests[ctx.APIVersion]
+	if !ok {
+		return Request{}, false
+	}
+	return Request{URL: fmt.Sprintf(r.url, test.TestID), ResponseObject: r.newResponse()}, true
+}
+
+// Decode returns the result as T with the account group set, nil if the response is not a T (GetTests logs and skips it)
+func (h resultHandler) Decode(ctx *TestContext, r Request) interface{} {
+	res := reflect.ValueOf(decodedResult(ctx, r))
+	if res.Kind() != reflect.Ptr || res.IsNil() || res.Elem().Type() != h.resultType() {
+		return nil
+	}
+	if ag := res.Elem().FieldByName("AccountGroup"); ag.IsValid() && ag.Type() == reflect.TypeOf(ctx.AccountGroup) {
+		ag.Set(reflect.ValueOf(ctx.AccountGroup))
+	}
+	if h.complete != nil {
+		h.complete(ctx, res.Interface())
+	}
+	return res.Elem().Interface()
+}
+
+// Collect passes the results to collect, results which are not a T are logged and skipped
+func (h resultHandler) Collect(results []interface{}, ch chan<- prometheus.Metric) {
+	collect := reflect.ValueOf(h.collect)
+	typed := reflect.MakeSlice(collect.Type().In(0), 0, len(results))
+	for _, r := range results {
+		if v := reflect.ValueOf(r); v.IsValid() && v.Type() == h.resultType() {
+			typed = reflect.Append(typed, v)
+			continue
+		}
+		log.Println(fmt.Sprintf("ERROR: Result %T of family %s is not a %s, it is skipped. Bug. Fix Code.", r, h.family, h.resultType()))
+	}
+	collect.Call([]reflect.Value{typed, reflect.ValueOf(ch)})
+}
+
+// resultType is T of collect
+func (h resultHandler) resultType() reflect.Type {
+	return reflect.TypeOf(h.collect).In(0).Elem()
+}
+
+// builtinTestHandlers are the handlers of all built-in families, in the order their requests are made
+func builtinTestHandlers(t *Collector) []TestHandler {
+	return []TestHandler{
+		newHTTPHandler(),
+		newHTTPMetricsHandler(),
+		newPageLoadHandler(),
+		newTransactionHandler(t.MaxTransactionSteps),
+		newFTPServerHandler(),
+		newDNSHandler(),
+		newDNSSECHandler(),
+		newNetworkHandler(),
+		newAgentToAgentHandler(),
+		newPathVisHandler(),
+		newVoiceHandler(),
+		newSIPServerHandler(),
+		newBGPHandler(),
+		newBGPRoutesHandler(t.ExpectedOriginAS),
+	}
+}
+
+// familyHandlers returns the built-in handlers of the families followed by the given handlers,
+// a given handler replaces the built-in handler of its family
+func familyHandlers(t *Collector, families []string, handlers []TestHandler) []TestHandler {
+	var selected []TestHandler
+	for _, h := range builtinTestHandlers(t) {
+		if hasFamily(families, h.Family()) && findHandler(handlers, h.Family()) == nil {
+			selected = append(selected, h)
+		}
+	}
+	return append(selected, handlers...)
+}
+
+func findHandler(handlers []TestHandler, family string) TestHandler {
+	for _, h := range handlers {
+		if h.Family() == family {
+			return h
+		}
+	}
+	return nil
+}
+
+func handles(h TestHandler, testType string) bool {
+	for _, tt := range h.TestTypes() {
+		if tt == testType {
+			return true
+		}
+	}
+	return false
+}
+
+// isTestTypeHandled is true if a registered or built-in handler knows the test type, collected or not
+func (t *Collector) isTestTypeHandled(testType string) bool {
+	for _, h := range append(append([]TestHandler{}, t.TestHandlers...), builtinTestHandlers(t)...) {
+		if handles(h, testType) {
+			return true
+		}
+	}
+	return false
+}
+
+// isFamily is true for the built-in families and the families of the handlers
+func isFamily(family string, handlers []TestHandler) bool {
+	return findHandler(handlers, family) != nil || findHandler(builtinTestHandlers(&Collector{}), family) != nil
+}
+
+// collectHandlerResults emits the metrics of the results of the handlers, results of families without handler are skipped
+func collectHandlerResults(r TestResults, handlers []TestHandler, ch chan<- prometheus.Metric) {
+	for _, h := range handlers {
+		if results, ok := r.Results[h.Family()]; ok {
+			h.Collect(results, ch)
+		}
+	}
+}
+
+// newHTTPHandler collects the web server results of http-server tests
+func newHTTPHandler() TestHandler {
+	return resultHandler{
+		handlerInfo: handlerInfo{
+			family:    FamilyHTTP,
+			testTypes: []string{"http-server"},
+			descs: []*prometheus.Desc{
+				ThousandTestHTMLconnectTimeDesc,
+				ThousandTestHTMLDNSTimeDesc,
+				ThousandTestHTMLRedirectsDesc,
+				ThousandTestHTMLreceiveTimeDesc,
+				ThousandTestHTMLresponseCodeDesc,
+				ThousandTestHTMLresponseTimeDesc,
+				ThousandTestHTMLTotalTimeDesc,
+				ThousandTestHTMLwaitTimeDesc,
+				ThousandTestHTMLwireSizeDesc,
+			},
+		},
+		requests: resultRequests{
+			APIVersion6: {apiURLTestHTTP, func() interface{} { return new(HTTPTestWebServerResults) }},
+			APIVersion7: {apiURLv7TestHTTP, func() interface{} { return new(v7HTTPServerResults) }},
+		},
+		collect: collectHTTPWeb,
+	}
+}
+
+// newHTTPMetricsHandler collects the network results of http-server tests
+func newHTTPMetricsHandler() TestHandler {
+	return resultHandler{
+		handlerInfo: handlerInfo{
+			family:    FamilyHTTPMetrics,
+			testTypes: []string{"http-server"},
+			descs: []*prometheus.Desc{
+				ThousandTestHTMLLossDesc,
+				ThousandTestHTMLAvgLatencyDesc,
+				ThousandTestHTMLMinLatencyDesc,
+				ThousandTestHTMLMaxLatencyDesc,
+				ThousandTestHTMLJitterDesc,
+			},
+		},
+		requests: networkRequests,
+		collect:  collectHTTPMetrics,
+	}
+}
+
+// newBGPHandler collects the reachability, updates and path changes of bgp tests
+func newBGPHandler() TestHandler {
+	return resultHandler{
+		handlerInfo: handlerInfo{
+			family:    FamilyBGP,
+			testTypes: []string{"bgp"},
+			descs: []*prometheus.Desc{
+				ThousandTestBGPReachabilityDesc,
+				ThousandTestBGPUpdatesDesc,
+				ThousandTestBGPPathChangesDesc,
+			},
+		},
+		requests: resultRequests{
+			APIVersion6: {apiURLTestBGB, func() interface{} { return new(BGPTestResults) }},
+			APIVersion7: {apiURLv7TestBGP, func() interface{} { return new(v7BGPResults) }},
+		},
+		collect: collectBGP,
+	}
+}
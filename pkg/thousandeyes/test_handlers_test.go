@@ -0,0 +1,84 @@
+package thousandeyes
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// drain collects the metrics of collect, so it does not block
+func drain(collect func(ch chan<- prometheus.Metric)) int {
+	ch := make(chan prometheus.Metric)
+	done := make(chan int)
+	go func() {
+		n := 0
+		for range ch {
+			n++
+		}
+		done <- n
+	}()
+	collect(ch)
+	close(ch)
+	return <-done
+}
+
+func TestBuiltinHandlersDecodeAndCollect(t *testing.T) {
+	ag := AccountGroup{AID: 42, Name: "ops"}
+
+	for _, h := range builtinTestHandlers(&Collector{}) {
+		for _, version := range []string{APIVersion6, APIVersion7} {
+			for _, testType := range h.TestTypes() {
+				t.Run(h.Family()+"/"+version+"/"+testType, func(t *testing.T) {
+					// the agents are known, so the handlers need no API call to name them
+					ctx := &TestContext{AccountGroup: ag, APIVersion: version, agents: map[int]ThousandAgent{}}
+
+					r, ok := h.Request(ctx, ThousandTest{TestID: 7, Type: testType})
+					if !ok {
+						if h.Family() != FamilyBGPRoutes || version != APIVersion7 {
+							t.Fatalf("no request")
+						}
+						return
+					}
+					if !strings.Contains(r.URL, "/7") {
+						t.Errorf("URL %s is not the one of test 7", r.URL)
+					}
+
+					res := h.Decode(ctx, r)
+					if res == nil {
+						t.Fatalf("response %T not decoded", r.ResponseObject)
+					}
+					if got := reflect.ValueOf(res).FieldByName("AccountGroup").Interface(); got != ag {
+						t.Errorf("account group %v, want %v", got, ag)
+					}
+
+					// a result of another type is skipped, not a panic
+					drain(func(ch chan<- prometheus.Metric) { h.Collect([]interface{}{res, "not a result", nil}, ch) })
+				})
+			}
+		}
+	}
+}
+
+func TestResultHandlerDecodeMismatch(t *testing.T) {
+	h := newHTTPHandler()
+	ctx := &TestContext{APIVersion: APIVersion6}
+
+	tests := []struct {
+		name     string
+		response interface{}
+	}{
+		{"other result type", new(BGPTestResults)},
+		{"no pointer", HTTPTestWebServerResults{}},
+		{"nil pointer", (*HTTPTestWebServerResults)(nil)},
+		{"nil", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if res := h.Decode(ctx, Request{ResponseObject: tt.response}); res != nil {
+				t.Errorf("decoded %T to %T", tt.response, res)
+			}
+		})
+	}
+}
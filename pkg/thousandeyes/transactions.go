@@ -0,0 +1,233 @@
+package thousandeyes
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"log"
+)
+
+const (
+	apiURLTestTransactions   = "https://api.thousandeyes.com/v6/web/transactions/%d.json"
+	apiURLv7TestTransactions = "https://api.thousandeyes.com/v7/test-results/%d/web-transactions"
+
+	// defaultMaxTransactionSteps is the number of distinct step names per test exported if not configured
+	defaultMaxTransactionSteps = 20
+
+	stepTypePage   = "page"
+	stepTypeMarker = "marker"
+)
+
+var (
+	// - transaction tests
+	ThousandTestTransactionTimeDesc = prometheus.NewDesc(
+		"thousandeyes_test_transaction_time_milliseconds",
+		"Transaction test ran in ThousandEyes - metric: transactionTime.",
+		agentTestLabels,
+		nil)
+	ThousandTestTransactionErrorDesc = prometheus.NewDesc(
+		"thousandeyes_test_transaction_error",
+		"Transaction test ran in ThousandEyes - 1 if the agent saw an error, its type is the label error_type.",
+		append(append([]string{}, agentTestLabels...), "error_type"),
+		nil)
+	ThousandTestTransactionStepDurationDesc = prometheus.NewDesc(
+		"thousandeyes_test_transaction_step_duration_milliseconds",
+		"Transaction test ran in ThousandEyes - metric: duration of a page or marker (step_type) of the transaction.",
+		append(append([]string{}, agentTestLabels...), "step_type", "step"),
+		nil)
+
+	//ThousandTestTransactionStepsDroppedMetric
+	ThousandTestTransactionStepsDroppedMetric = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "thousandeyes_test_transaction_steps_dropped_total",
+		Help: "The number of transaction steps not exported, because their test has more distinct step names than allowed (max_transaction_steps).",
+	})
+)
+
+//https://api.thousandeyes.com/v6/web/transactions/612434.json
+
+// TransactionTestResults transaction (scripted browser) test details
+type TransactionTestResults struct {
+	Web struct {
+		Test        ThousandTest        `json:"test"`
+		Transaction []TransactionResult `json:"transaction"`
+	} `json:"web"`
+	Pages Pages `json:"pages"`
+	// AccountGroup the test belongs to
+	AccountGroup AccountGroup `json:"-"`
+}
+
+// TransactionResult transaction run by an agent
+type TransactionResult struct {
+	TransactionTime int               `json:"transactionTime"`
+	NumSteps        int               `json:"numSteps"`
+	ErrorType       string            `json:"errorType"`
+	Pages           []TransactionPage `json:"pages,omitempty"`
+	Markers         []TransactionStep `json:"markers,omitempty"`
+	AgentName       string            `json:"agentName"`
+	CountryID       string            `json:"countryId"`
+	Date            string            `json:"date"`
+	AgentID         int               `json:"agentId"`
+	RoundID         int               `json:"roundId"`
+}
+
+// TransactionPage is a page loaded by the transaction script
+type TransactionPage struct {
+	PageNum  int    `json:"pageNum"`
+	PageName string `json:"pageName"`
+	Duration int    `json:"duration"`
+}
+
+// TransactionStep is a marker set by the transaction script
+type TransactionStep struct {
+	Marker   string `json:"marker"`
+	Duration int    `json:"duration"`
+}
+
+func (r *TransactionTestResults) nextPage() string { return r.Pages.Next }
+func (r *TransactionTestResults) appendPage(page interface{}) {
+	r.Web.Transaction = append(r.Web.Transaction, page.(*TransactionTestResults).Web.Transaction...)
+}
+
+type v7TransactionResults struct {
+	Test    v7Test `json:"test"`
+	Results []struct {
+		TransactionResult
+		AgentID string `json:"agentId"`
+	} `json:"results"`
+	Links v7Links `json:"_links"`
+}
+
+func (r *v7TransactionResults) nextPage() string { return r.Links.Next.Href }
+func (r *v7TransactionResults) appendPage(page interface{}) {
+	r.Results = append(r.Results, page.(*v7TransactionResults).Results...)
+}
+
+func (r *v7TransactionResults) result(ctx *TestContext) interface{} {
+	res := new(TransactionTestResults)
+	res.Web.Test = r.Test.toV6()
+	for _, m := range r.Results {
+		transaction := m.TransactionResult
+		transaction.AgentID = v7ID(m.AgentID)
+		agent := ctx.v7Agent(m.AgentID)
+		transaction.AgentName = agent.AgentName
+		transaction.CountryID = agent.CountryID
+		res.Web.Transaction = append(res.Web.Transaction, transaction)
+	}
+	return res
+}
+
+// capSteps drops the steps of step names beyond the first max distinct ones of the test,
+// the step name is a label and scripts with generated marker names must not blow up the series count
+func (r *TransactionTestResults) capSteps(max int) {
+	if max <= 0 {
+		max = defaultMaxTransactionSteps
+	}
+
+	steps := map[string]bool{}
+	keep := func(stepType string, name string) bool {
+		key := stepType + "/" + name
+		if steps[key] {
+			return true
+		}
+		if len(steps) >= max {
+			ThousandTestTransactionStepsDroppedMetric.Inc()
+			return false
+		}
+		steps[key] = true
+		return true
+	}
+
+	for i := range r.Web.Transaction {
+		t := &r.Web.Transaction[i]
+		// a step name repeated within the transaction would be a duplicate series, the first one wins
+		seen := map[string]bool{}
+
+		var pages []TransactionPage
+		for _, p := range t.Pages {
+			if !seen[stepTypePage+"/"+p.PageName] && keep(stepTypePage, p.PageName) {
+				seen[stepTypePage+"/"+p.PageName] = true
+				pages = append(pages, p)
+			}
+		}
+		t.Pages = pages
+
+		var markers []TransactionStep
+		for _, m := range t.Markers {
+			if !seen[stepTypeMarker+"/"+m.Marker] && keep(stepTypeMarker, m.Marker) {
+				seen[stepTypeMarker+"/"+m.Marker] = true
+				markers = append(markers, m)
+			}
+		}
+		t.Markers = markers
+	}
+}
+
+// newTransactionHandler collects the transaction times and steps of transaction tests, maxSteps caps the step names per test
+func newTransactionHandler(maxSteps int) TestHandler {
+	return resultHandler{
+		handlerInfo: handlerInfo{
+			family:    FamilyTransaction,
+			testTypes: []string{"transactions", "web-transactions"},
+			descs: []*prometheus.Desc{
+				ThousandTestTransactionTimeDesc,
+				ThousandTestTransactionErrorDesc,
+				ThousandTestTransactionStepDurationDesc,
+			},
+		},
+		requests: resultRequests{
+			APIVersion6: {apiURLTestTransactions, func() interface{} { return new(TransactionTestResults) }},
+			APIVersion7: {apiURLv7TestTransactions, func() interface{} { return new(v7TransactionResults) }},
+		},
+		complete: func(ctx *TestContext, result interface{}) {
+			result.(*TransactionTestResults).capSteps(maxSteps)
+		},
+		collect: collectTransactions,
+	}
+}
+
+func collectTransactions(tTransactions []TransactionTestResults, ch chan<- prometheus.Metric) {
+
+	for e := range tTransactions {
+		if len(tTransactions[e].Web.Transaction) == 0 {
+			log.Println("INFO: Transaction metrics are empty for Test:", tTransactions[e])
+			continue
+		}
+		for _, t := range tTransactions[e].Web.Transaction {
+
+			labels := agentTestLabelValues(tTransactions[e].Web.Test, t.CountryID, t.AgentName, tTransactions[e].AccountGroup)
+
+			ch <- prometheus.MustNewConstMetric(
+				ThousandTestTransactionTimeDesc,
+				prometheus.GaugeValue,
+				float64(t.TransactionTime),
+				labels...,
+			)
+
+			isError := 0.0
+			if isErrorType(t.ErrorType) {
+				isError = 1
+			}
+			ch <- prometheus.MustNewConstMetric(
+				ThousandTestTransactionErrorDesc,
+				prometheus.GaugeValue,
+				isError,
+				append(labels, t.ErrorType)...,
+			)
+
+			for _, p := range t.Pages {
+				ch <- prometheus.MustNewConstMetric(
+					ThousandTestTransactionStepDurationDesc,
+					prometheus.GaugeValue,
+					float64(p.Duration),
+					append(labels, stepTypePage, p.PageName)...,
+				)
+			}
+			for _, m := range t.Markers {
+				ch <- prometheus.MustNewConstMetric(
+					ThousandTestTransactionStepDurationDesc,
+					prometheus.GaugeValue,
+					float64(m.Duration),
+					append(labels, stepTypeMarker, m.Marker)...,
+				)
+			}
+		}
+	}
+}
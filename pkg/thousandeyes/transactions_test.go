@@ -0,0 +1,114 @@
+package thousandeyes
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestTransactionCapSteps(t *testing.T) {
+	pages := func(names ...string) []TransactionPage {
+		var p []TransactionPage
+		for i, n := range names {
+			p = append(p, TransactionPage{PageNum: i + 1, PageName: n, Duration: 10 * (i + 1)})
+		}
+		return p
+	}
+	markers := func(names ...string) []TransactionStep {
+		var m []TransactionStep
+		for i, n := range names {
+			m = append(m, TransactionStep{Marker: n, Duration: i + 1})
+		}
+		return m
+	}
+
+	tests := []struct {
+		name        string
+		max         int
+		results     []TransactionResult
+		wantPages   [][]string
+		wantMarkers [][]string
+		wantDropped float64
+	}{
+		{
+			name:        "below the cap",
+			max:         3,
+			results:     []TransactionResult{{Pages: pages("login"), Markers: markers("search")}},
+			wantPages:   [][]string{{"login"}},
+			wantMarkers: [][]string{{"search"}},
+		},
+		{
+			name: "steps beyond the cap are dropped",
+			max:  2,
+			results: []TransactionResult{
+				{Pages: pages("login", "cart"), Markers: markers("search")},
+			},
+			wantPages:   [][]string{{"login", "cart"}},
+			wantMarkers: [][]string{nil},
+			wantDropped: 1,
+		},
+		{
+			name: "the cap counts the distinct names of the test",
+			max:  2,
+			results: []TransactionResult{
+				{Pages: pages("login"), Markers: markers("id-1")},
+				{Pages: pages("login"), Markers: markers("id-2", "id-1")},
+			},
+			wantPages:   [][]string{{"login"}, {"login"}},
+			wantMarkers: [][]string{{"id-1"}, {"id-1"}},
+			wantDropped: 1,
+		},
+		{
+			name:        "a page and a marker of the same name are different steps",
+			max:         2,
+			results:     []TransactionResult{{Pages: pages("login"), Markers: markers("login")}},
+			wantPages:   [][]string{{"login"}},
+			wantMarkers: [][]string{{"login"}},
+		},
+		{
+			name:        "a name repeated in the transaction is kept once",
+			max:         5,
+			results:     []TransactionResult{{Pages: pages("login", "login"), Markers: markers("step", "step")}},
+			wantPages:   [][]string{{"login"}},
+			wantMarkers: [][]string{{"step"}},
+		},
+		{
+			name:        "no cap configured uses the default",
+			max:         0,
+			results:     []TransactionResult{{Markers: markers("1", "2", "3", "4", "5", "6", "7", "8", "9", "10", "11", "12", "13", "14", "15", "16", "17", "18", "19", "20", "21")}},
+			wantPages:   [][]string{nil},
+			wantMarkers: [][]string{{"1", "2", "3", "4", "5", "6", "7", "8", "9", "10", "11", "12", "13", "14", "15", "16", "17", "18", "19", "20"}},
+			wantDropped: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := new(TransactionTestResults)
+			r.Web.Transaction = tt.results
+
+			dropped := testutil.ToFloat64(ThousandTestTransactionStepsDroppedMetric)
+			r.capSteps(tt.max)
+
+			for i, transaction := range r.Web.Transaction {
+				var gotPages, gotMarkers []string
+				for _, p := range transaction.Pages {
+					gotPages = append(gotPages, p.PageName)
+				}
+				for _, m := range transaction.Markers {
+					gotMarkers = append(gotMarkers, m.Marker)
+				}
+				if !reflect.DeepEqual(gotPages, tt.wantPages[i]) {
+					t.Errorf("transaction %d pages %v, want %v", i, gotPages, tt.wantPages[i])
+				}
+				if !reflect.DeepEqual(gotMarkers, tt.wantMarkers[i]) {
+					t.Errorf("transaction %d markers %v, want %v", i, gotMarkers, tt.wantMarkers[i])
+				}
+			}
+			if got := testutil.ToFloat64(ThousandTestTransactionStepsDroppedMetric) - dropped; got != tt.wantDropped {
+				t.Errorf("dropped %v steps, want %v", got, tt.wantDropped)
+			}
+		})
+	}
+}
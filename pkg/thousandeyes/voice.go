@@ -0,0 +1,176 @@
+package thousandeyes
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"log"
+)
+
+const (
+	apiURLTestVoice   = "https://api.thousandeyes.com/v6/voice/metrics/%d.json"
+	apiURLv7TestVoice = "https://api.thousandeyes.com/v7/test-results/%d/rtp-stream"
+)
+
+// voiceTestLabels are the labels of voice test metrics, agent_name is the source of the RTP stream
+var voiceTestLabels = append(append([]string{}, agentTestLabels...), "target_agent")
+
+var (
+	// - voice tests
+	ThousandTestVoiceMOSDesc = prometheus.NewDesc(
+		"thousandeyes_test_voice_mos",
+		"Voice test ran in ThousandEyes - metric: mos (mean opinion score).",
+		voiceTestLabels,
+		nil)
+	ThousandTestVoiceLossDesc = prometheus.NewDesc(
+		"thousandeyes_test_voice_loss_percentage",
+		"Voice test ran in ThousandEyes - metric: loss.",
+		voiceTestLabels,
+		nil)
+	ThousandTestVoiceDiscardsDesc = prometheus.NewDesc(
+		"thousandeyes_test_voice_discards_percentage",
+		"Voice test ran in ThousandEyes - metric: discards.",
+		voiceTestLabels,
+		nil)
+	ThousandTestVoiceLatencyDesc = prometheus.NewDesc(
+		"thousandeyes_test_voice_latency_milliseconds",
+		"Voice test ran in ThousandEyes - metric: latency.",
+		voiceTestLabels,
+		nil)
+	ThousandTestVoicePDVDesc = prometheus.NewDesc(
+		"thousandeyes_test_voice_pdv_milliseconds",
+		"Voice test ran in ThousandEyes - metric: pdv (packet delay variation).",
+		voiceTestLabels,
+		nil)
+)
+
+//https://api.thousandeyes.com/v6/voice/metrics/612434.json
+
+// VoiceTestResults voice (RTP stream) test details
+type VoiceTestResults struct {
+	Voice struct {
+		Test    ThousandTest  `json:"test"`
+		Metrics []VoiceMetric `json:"metrics"`
+	} `json:"voice"`
+	Pages Pages `json:"pages"`
+	// AccountGroup the test belongs to
+	AccountGroup AccountGroup `json:"-"`
+	// TargetAgentName is the name of the target agent of the test, resolved by the agents of the account group
+	TargetAgentName string `json:"-"`
+}
+
+// VoiceMetric RTP stream metrics of an agent
+type VoiceMetric struct {
+	MOS       float32 `json:"mos"`
+	Loss      float32 `json:"loss"`
+	Discards  float32 `json:"discards"`
+	Latency   float32 `json:"latency"`
+	PDV       float32 `json:"pdv"`
+	AgentName string  `json:"agentName"`
+	CountryID string  `json:"countryId"`
+	Date      string  `json:"date"`
+	AgentID   int     `json:"agentId"`
+	RoundID   int     `json:"roundId"`
+}
+
+func (r *VoiceTestResults) nextPage() string { return r.Pages.Next }
+func (r *VoiceTestResults) appendPage(page interface{}) {
+	r.Voice.Metrics = append(r.Voice.Metrics, page.(*VoiceTestResults).Voice.Metrics...)
+}
+
+type v7VoiceResults struct {
+	Test    v7Test `json:"test"`
+	Results []struct {
+		VoiceMetric
+		AgentID string `json:"agentId"`
+	} `json:"results"`
+	Links v7Links `json:"_links"`
+}
+
+func (r *v7VoiceResults) nextPage() string { return r.Links.Next.Href }
+func (r *v7VoiceResults) appendPage(page interface{}) {
+	r.Results = append(r.Results, page.(*v7VoiceResults).Results...)
+}
+
+func (r *v7VoiceResults) result(ctx *TestContext) interface{} {
+	res := new(VoiceTestResults)
+	res.Voice.Test = r.Test.toV6()
+	for _, m := range r.Results {
+		metric := m.VoiceMetric
+		metric.AgentID = v7ID(m.AgentID)
+		agent := ctx.v7Agent(m.AgentID)
+		metric.AgentName = agent.AgentName
+		metric.CountryID = agent.CountryID
+		res.Voice.Metrics = append(res.Voice.Metrics, metric)
+	}
+	return res
+}
+
+// newVoiceHandler collects the RTP stream metrics of voice tests
+func newVoiceHandler() TestHandler {
+	return resultHandler{
+		handlerInfo: handlerInfo{
+			family:    FamilyVoice,
+			testTypes: []string{"voice"},
+			descs: []*prometheus.Desc{
+				ThousandTestVoiceMOSDesc,
+				ThousandTestVoiceLossDesc,
+				ThousandTestVoiceDiscardsDesc,
+				ThousandTestVoiceLatencyDesc,
+				ThousandTestVoicePDVDesc,
+			},
+		},
+		requests: resultRequests{
+			APIVersion6: {apiURLTestVoice, func() interface{} { return new(VoiceTestResults) }},
+			APIVersion7: {apiURLv7TestVoice, func() interface{} { return new(v7VoiceResults) }},
+		},
+		complete: func(ctx *TestContext, result interface{}) {
+			res := result.(*VoiceTestResults)
+			res.TargetAgentName = ctx.agentName(res.Voice.Test.TargetAgentID)
+		},
+		collect: collectVoice,
+	}
+}
+
+func collectVoice(tVoice []VoiceTestResults, ch chan<- prometheus.Metric) {
+
+	for e := range tVoice {
+		if len(tVoice[e].Voice.Metrics) == 0 {
+			log.Println("INFO: Voice metrics are empty for Test:", tVoice[e])
+			continue
+		}
+		for _, m := range tVoice[e].Voice.Metrics {
+
+			labels := append(agentTestLabelValues(tVoice[e].Voice.Test, m.CountryID, m.AgentName, tVoice[e].AccountGroup), tVoice[e].TargetAgentName)
+
+			ch <- prometheus.MustNewConstMetric(
+				ThousandTestVoiceMOSDesc,
+				prometheus.GaugeValue,
+				float64(m.MOS),
+				labels...,
+			)
+			ch <- prometheus.MustNewConstMetric(
+				ThousandTestVoiceLossDesc,
+				prometheus.GaugeValue,
+				float64(m.Loss),
+				labels...,
+			)
+			ch <- prometheus.MustNewConstMetric(
+				ThousandTestVoiceDiscardsDesc,
+				prometheus.GaugeValue,
+				float64(m.Discards),
+				labels...,
+			)
+			ch <- prometheus.MustNewConstMetric(
+				ThousandTestVoiceLatencyDesc,
+				prometheus.GaugeValue,
+				float64(m.Latency),
+				labels...,
+			)
+			ch <- prometheus.MustNewConstMetric(
+				ThousandTestVoicePDVDesc,
+				prometheus.GaugeValue,
+				float64(m.PDV),
+				labels...,
+			)
+		}
+	}
+}